@@ -0,0 +1,45 @@
+//
+// File:        internal/kosync/api_admin.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireAdmin rejects requests of users without admin rights and records all other requests in the audit log
+func (app *Kosync) RequireAdmin(c *fiber.Ctx) error {
+	username, _ := c.Locals("current_user").(string)
+	app.LockDb()
+	isAdmin := app.Db.Users[username].IsAdmin
+	app.DbLock.Unlock()
+	if !isAdmin {
+		app.RequestLogger(c, "Admin").Debug("Rejected request of non-admin user")
+		return fiber.ErrForbidden
+	}
+
+	app.Audit(c, AuditAdminAction, username, map[string]string{
+		"method": c.Method(),
+		"path":   c.Path(),
+	})
+	return c.Next()
+}
+
+func (app *Kosync) ApiGetAudit(c *fiber.Ctx) error {
+	query := AuditQuery{
+		Username: c.Query("username"),
+		Event:    c.Query("event"),
+		Since:    int64(c.QueryInt("since", 0)),
+		Until:    int64(c.QueryInt("until", 0)),
+		Limit:    c.QueryInt("limit", AuditDefaultQueryLimit),
+	}
+
+	entries, err := app.QueryAudit(query)
+	if err != nil {
+		return err
+	}
+	return c.JSON(entries)
+}
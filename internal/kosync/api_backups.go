@@ -0,0 +1,105 @@
+//
+// File:        internal/kosync/api_backups.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type BackupFileData struct {
+	File      string `json:"file"`
+	CreatedAt int64  `json:"created_at"`
+	Size      int64  `json:"size"`
+}
+
+// ApiPostBackupCreate creates a backup and sends the file as a download
+func (app *Kosync) ApiPostBackupCreate(c *fiber.Ctx) error {
+	backupFile, err := app.BackupDatabase()
+	if err != nil {
+		app.RequestLogger(c, "Backup").Error("Failed to create backup", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create backup")
+	}
+
+	c.Set(fiber.HeaderContentType, "application/x-pem-file")
+	return c.Download(backupFile, filepath.Base(backupFile))
+}
+
+// ApiGetBackups lists the backup files in the backup directory, newest first
+func (app *Kosync) ApiGetBackups(c *fiber.Ctx) error {
+	app.LockDb()
+	backupDir := app.BackupDirectory()
+	app.DbLock.Unlock()
+
+	names, err := ListBackups(backupDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	backups := make([]BackupFileData, 0, len(names))
+	for _, name := range names {
+		stat, err := os.Stat(filepath.Join(backupDir, name))
+		if err != nil {
+			continue
+		}
+		createdAt, _ := ParseBackupFileName(name)
+		backups = append(backups, BackupFileData{
+			File:      name,
+			CreatedAt: createdAt.Unix(),
+			Size:      stat.Size(),
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt > backups[j].CreatedAt
+	})
+	return c.JSON(backups)
+}
+
+// ApiPostBackupRestore restores the uploaded backup file into the running server.
+// The query parameters users and documents restore only a part of the backup, dry_run only reports the changes.
+func (app *Kosync) ApiPostBackupRestore(c *fiber.Ctx) error {
+	var backupData []byte
+	if file, err := c.FormFile("backup"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return err
+		}
+		backupData, err = io.ReadAll(f)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+	} else {
+		backupData = c.Body()
+	}
+	if len(backupData) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "No backup file uploaded")
+	}
+
+	options := RestoreOptions{
+		Users:     normalizeList(strings.Split(c.Query("users"), ",")),
+		Documents: normalizeList(strings.Split(c.Query("documents"), ",")),
+		DryRun:    c.QueryBool("dry_run", false),
+	}
+	changes, err := app.RestoreBackupData(backupData, options)
+	if err != nil {
+		app.RequestLogger(c, "Restore").Error("Failed to restore uploaded backup", "error", err)
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if !options.DryRun {
+		username, _ := c.Locals("current_user").(string)
+		app.Audit(c, AuditDatabaseRestored, username, restoreAuditDetails("upload", options))
+		app.AuditRestoredDeletions(c, changes)
+	}
+	return c.JSON(changes)
+}
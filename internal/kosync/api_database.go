@@ -0,0 +1,58 @@
+//
+// File:        internal/kosync/api_database.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ApiGetDatabaseExport sends the database in the export format of the format query parameter as a download
+func (app *Kosync) ApiGetDatabaseExport(c *fiber.Ctx) error {
+	format := c.Query("format", ExportFormatJsonl)
+
+	var export bytes.Buffer
+	app.LockDb()
+	err := WriteExport(&export, ExportRecords(app.Db), format)
+	app.DbLock.Unlock()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	c.Set(fiber.HeaderContentType, ExportContentType(format))
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="kosync.%s"`, format))
+	return c.Send(export.Bytes())
+}
+
+// ApiPostDatabaseImport merges the uploaded export into the database, dry_run only reports what would be imported
+func (app *Kosync) ApiPostDatabaseImport(c *fiber.Ctx) error {
+	var importData io.Reader = bytes.NewReader(c.Body())
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		importData = f
+	}
+
+	records, err := ReadImport(importData, c.Query("format", ExportFormatJsonl))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	result, err := app.ImportRecords(records, c.QueryBool("dry_run", false))
+	if err != nil {
+		app.RequestLogger(c, "DB").Error("Failed to import records", "error", err)
+		return err
+	}
+	return c.JSON(result)
+}
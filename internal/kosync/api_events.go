@@ -0,0 +1,75 @@
+//
+// File:        internal/kosync/api_events.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const EventKeepAliveInterval = 15 * time.Second
+
+// ApiGetEvents streams changes of the authenticated user as Server-Sent Events
+func (app *Kosync) ApiGetEvents(c *fiber.Ctx) error {
+	// The context is released when the handler returns, so copy what the stream needs
+	username := c.Locals("current_user").(string)
+	logger := app.Logger("Events")
+	if requestId, ok := c.Locals("requestid").(string); ok {
+		// The request id may be taken from the X-Request-ID header, whose buffer is reused for the next request
+		logger = logger.With("request_id", strings.Clone(requestId))
+	}
+	logger = logger.With("user", username)
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	c.Set("Access-Control-Allow-Origin", "*")
+
+	events := app.Events.Subscribe(username)
+	logger.Debug("Subscribed to events")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer app.Events.Unsubscribe(username, events)
+		keepAlive := time.NewTicker(EventKeepAliveInterval)
+		defer keepAlive.Stop()
+
+		_, _ = fmt.Fprint(w, ": connected\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					logger.Error("Failed to marshal event", "error", err)
+					continue
+				}
+				_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			case <-keepAlive.C:
+				_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			// Flushing fails once the client has gone away
+			if err := w.Flush(); err != nil {
+				logger.Debug("Unsubscribed from events")
+				return
+			}
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,86 @@
+//
+// File:        internal/kosync/api_health.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type HealthData struct {
+	Status  string                     `json:"status"`
+	Version string                     `json:"version"`
+	Checks  map[string]HealthCheckData `json:"checks,omitempty"`
+}
+
+type HealthCheckData struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// ApiGetHealth reports that the process is alive
+func (app *Kosync) ApiGetHealth(c *fiber.Ctx) error {
+	return c.JSON(HealthData{Status: "ok", Version: Version})
+}
+
+// ApiGetReady reports whether the server can handle requests, responds with 503 when a check fails
+func (app *Kosync) ApiGetReady(c *fiber.Ctx) error {
+	checks := app.ReadinessChecks()
+
+	result := HealthData{Status: "ok", Version: Version, Checks: checks}
+	for _, check := range checks {
+		if !check.Ok {
+			result.Status = "unavailable"
+			c.Status(fiber.StatusServiceUnavailable)
+		}
+	}
+	return c.JSON(result)
+}
+
+func (app *Kosync) ReadinessChecks() map[string]HealthCheckData {
+	checks := make(map[string]HealthCheckData)
+	app.LockDb()
+	loaded, schema := app.Db.Users != nil, app.Db.Schema
+	app.DbLock.Unlock()
+
+	checks["database"] = HealthCheckData{Ok: loaded}
+	if !checks["database"].Ok {
+		checks["database"] = HealthCheckData{Message: "database is not loaded"}
+	}
+
+	checks["migrations"] = HealthCheckData{Ok: schema == SchemaVersion}
+	if !checks["migrations"].Ok {
+		checks["migrations"] = HealthCheckData{Message: fmt.Sprintf("database has schema %d, expected %d", schema, SchemaVersion)}
+	}
+
+	checks["storage"] = HealthCheckData{Ok: true}
+	if err := checkDirectoryWritable(filepath.Dir(app.DbFile)); err != nil {
+		checks["storage"] = HealthCheckData{Message: err.Error()}
+	}
+
+	checks["persist"] = HealthCheckData{Ok: true}
+	if persistError, _ := app.LastPersistError.Load().(string); len(persistError) > 0 {
+		checks["persist"] = HealthCheckData{Message: persistError}
+	}
+
+	return checks
+}
+
+func checkDirectoryWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".kosync-ready-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
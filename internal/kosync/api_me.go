@@ -0,0 +1,144 @@
+//
+// File:        internal/kosync/api_me.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AccountData struct {
+	Username       string `json:"username"`
+	Tenant         string `json:"tenant"`
+	IsAdmin        bool   `json:"is_admin"`
+	Documents      int    `json:"documents"`
+	HistoryEntries int    `json:"history_entries"`
+	Aliases        int    `json:"aliases"`
+	Webhooks       int    `json:"webhooks"`
+}
+
+// ApiGetMe returns the account of the authenticated user
+func (app *Kosync) ApiGetMe(c *fiber.Ctx) error {
+	app.LockDb()
+	user, found := app.Db.Users[c.Locals("current_user").(string)]
+	account := accountOf(user)
+	app.DbLock.Unlock()
+	if !found {
+		return fiber.ErrNotFound
+	}
+	return c.JSON(account)
+}
+
+func accountOf(user UserData) AccountData {
+	account := AccountData{
+		Username:  user.Username,
+		Tenant:    user.Tenant,
+		IsAdmin:   user.IsAdmin,
+		Documents: len(user.Documents),
+		Aliases:   len(user.Aliases),
+		Webhooks:  len(user.Webhooks),
+	}
+	for _, history := range user.History {
+		account.HistoryEntries += len(history.DocumentHistory)
+	}
+	return account
+}
+
+// ApiPutMePassword changes the password of the authenticated user and returns the new key
+func (app *Kosync) ApiPutMePassword(c *fiber.Ctx) error {
+	var data struct {
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return err
+	}
+	if len(data.Password) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "password must not be empty")
+	}
+
+	username := c.Locals("current_user").(string)
+	key := PasswordKey(data.Password)
+	if err := app.ChangeUserPassword(username, key); err != nil {
+		return err
+	}
+	app.RequestLogger(c, "Users").Info("Changed password")
+	app.Audit(c, AuditPasswordChanged, username, nil)
+	return c.JSON(fiber.Map{"key": key})
+}
+
+// ApiPutMeUsername renames the authenticated user
+func (app *Kosync) ApiPutMeUsername(c *fiber.Ctx) error {
+	var data struct {
+		Username string `json:"username"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return err
+	}
+	data.Username = strings.TrimSpace(data.Username)
+	if len(data.Username) == 0 || (app.TenantsConfigured() && strings.Contains(data.Username, TenantSeparator)) {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("username must not be empty or contain '%s'", TenantSeparator))
+	}
+
+	username := c.Locals("current_user").(string)
+	app.LockDb()
+	_, taken := app.Db.Users[UserKey(CurrentTenant(c), data.Username)]
+	app.DbLock.Unlock()
+	if taken {
+		return fiber.NewError(fiber.StatusConflict, "username is already taken")
+	}
+
+	if err := app.RenameUser(username, data.Username); err != nil {
+		return err
+	}
+	app.RequestLogger(c, "Users").Info("Renamed user", "username", data.Username)
+	app.Audit(c, AuditUserRenamed, UserKey(CurrentTenant(c), data.Username), map[string]string{"previous_username": username})
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ApiGetMeExport sends everything stored about the authenticated user as JSON or zip download
+func (app *Kosync) ApiGetMeExport(c *fiber.Ctx) error {
+	username := c.Locals("current_user").(string)
+	format := c.Query("format", UserExportFormatJson)
+	if format != UserExportFormatJson && format != UserExportFormatZip {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("export format '%s' is not supported, available are %s and %s", format, UserExportFormatJson, UserExportFormatZip))
+	}
+
+	export, err := app.ExportUser(username)
+	if err != nil {
+		return fiber.ErrNotFound
+	}
+	app.RequestLogger(c, "Users").Debug("Exported user data", "format", format)
+
+	// Usernames may contain quotes or other characters that break the header, so the filename is quoted or encoded as needed
+	filename := fmt.Sprintf("kosync-%s.%s", strings.ReplaceAll(username, TenantSeparator, "_"), format)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	if format == UserExportFormatZip {
+		var archive bytes.Buffer
+		if err := WriteUserExportZip(&archive, export); err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, "application/zip")
+		return c.Send(archive.Bytes())
+	}
+	return c.JSON(export)
+}
+
+// ApiDeleteMe erases the account of the authenticated user with all of their data
+func (app *Kosync) ApiDeleteMe(c *fiber.Ctx) error {
+	username := c.Locals("current_user").(string)
+	pseudonym, err := app.DeleteUser(username)
+	if err != nil {
+		return err
+	}
+	app.RequestLogger(c, "Users").Info("Deleted user account")
+	app.Audit(c, AuditUserDeleted, pseudonym, nil)
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,57 @@
+//
+// File:        internal/kosync/api_me_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"mime"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestApiGetMeExportFilename(t *testing.T) {
+	tests := []struct {
+		tenant   string
+		username string
+		filename string
+	}{
+		{"", "alice", "kosync-alice.json"},
+		{"", `ali"ce; filename=evil.exe`, `kosync-ali"ce; filename=evil.exe.json`},
+		{"", "jürgen", "kosync-jürgen.json"},
+		{"family", "carol", "kosync-family_carol.json"},
+	}
+	app := newTestApp(t)
+	fiberApp := fiber.New()
+	fiberApp.Use(func(c *fiber.Ctx) error {
+		c.Locals("current_user", c.Get("x-test-user"))
+		return c.Next()
+	})
+	fiberApp.Get("/api/me/export", app.ApiGetMeExport)
+
+	for _, test := range tests {
+		t.Run(test.username, func(t *testing.T) {
+			addTestUser(app, test.tenant, test.username)
+			req := httptest.NewRequest(fiber.MethodGet, "/api/me/export", nil)
+			req.Header.Set("x-test-user", UserKey(test.tenant, test.username))
+			resp, err := fiberApp.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != fiber.StatusOK {
+				t.Fatalf("status is %d", resp.StatusCode)
+			}
+
+			header := resp.Header.Get(fiber.HeaderContentDisposition)
+			disposition, params, err := mime.ParseMediaType(header)
+			if err != nil || disposition != "attachment" || len(params) != 1 || params["filename"] != test.filename {
+				t.Errorf("Content-Disposition %q was parsed as %s %v (%v)", header, disposition, params, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+//
+// File:        internal/kosync/api_metrics.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func (app *Kosync) MetricsHandler(c *fiber.Ctx) error {
+	var buffer bytes.Buffer
+	app.WriteMetrics(&buffer)
+
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return c.Send(buffer.Bytes())
+}
+
+// ListenMetrics serves the metrics on their own address, so they are not exposed next to the sync API
+func (app *Kosync) ListenMetrics(address string) {
+	metricsApp := fiber.New(fiber.Config{
+		AppName:               fmt.Sprintf("KOsync v%s Metrics", Version),
+		DisableStartupMessage: true,
+	})
+	metricsApp.Get("/metrics", app.MetricsHandler)
+
+	app.Logger("Metrics").Info("Serving metrics", "address", address)
+	if err := metricsApp.Listen(address); err != nil {
+		app.Logger("Metrics").Error("Failed to serve metrics", "error", err)
+	}
+}
@@ -0,0 +1,23 @@
+//
+// File:        internal/kosync/api_stats.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+func (app *Kosync) ApiGetStats(c *fiber.Ctx) error {
+	username := c.Locals("current_user").(string)
+	stats, found := app.GetStats(username)
+	if !found {
+		return fiber.ErrNotFound
+	}
+	app.RequestLogger(c, "Stats").Debug("Requested statistics")
+
+	c.Set("Access-Control-Allow-Origin", "*")
+	return c.JSON(stats)
+}
@@ -13,16 +13,38 @@ import (
 )
 
 func (app *Kosync) SyncsPostProgress(c *fiber.Ctx) error {
+	limits := app.CurrentLimits()
+	if err := limits.CheckBody(c); err != nil {
+		return err
+	}
+
 	// Parse payload
 	var data DocumentData
 	if err := c.BodyParser(&data); err != nil {
-		return err
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+	}
+	if err := data.Validate(); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	for _, field := range [][2]string{{"progress", data.Progress}, {"device", data.Device}, {"device_id", data.DeviceId}} {
+		if err := limits.CheckField(field[0], field[1]); err != nil {
+			return err
+		}
 	}
 
-	app.PrintDebug("Syncs", c.Locals("requestid").(string), fmt.Sprintf("User '%s' sent progress for document '%s'", c.Locals("current_user").(string), data.Document))
+	app.RequestLogger(c, "Syncs").Debug("Progress pushed", "document", data.Document)
 	if err := app.AddOrUpdateDocument(c.Locals("current_user").(string), data); err != nil {
 		return err
 	}
+	// Usernames and device names are only exposed on the separate metrics address, the public /metrics has no authentication
+	progressPushesTotal.Inc()
+	app.LockDb()
+	metricsAddress := app.Db.Config.MetricsAddress
+	app.DbLock.Unlock()
+	if len(metricsAddress) > 0 {
+		userProgressPushesTotal.Inc(c.Locals("current_user").(string), data.Device)
+	}
 
 	return c.SendStatus(fiber.StatusOK)
 }
@@ -32,10 +54,13 @@ func (app *Kosync) SyncsGetProgress(c *fiber.Ctx) error {
 	if documentId == "-" {
 		return fiber.ErrNotFound
 	}
-	app.PrintDebug("Syncs", c.Locals("requestid").(string), fmt.Sprintf("User '%s' requested progress of document '%s'", c.Locals("current_user").(string), documentId))
+	app.RequestLogger(c, "Syncs").Debug("Progress requested", "document", documentId)
 
-	// Find document
-	docData, found := app.Db.Users[c.Locals("current_user").(string)].Documents[documentId]
+	// Find document, merged documents share the progress of their canonical document
+	app.LockDb()
+	user := app.Db.Users[c.Locals("current_user").(string)]
+	docData, found := user.Documents[user.ResolveDocumentId(documentId)]
+	app.DbLock.Unlock()
 	if !found {
 		return fiber.ErrNotFound
 	}
@@ -0,0 +1,144 @@
+//
+// File:        internal/kosync/api_syncs_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Content types KOReader and browsers send, the fuzzer picks one by index so the request stays valid HTTP
+var syncsContentTypes = []string{fiber.MIMEApplicationJSON, fiber.MIMEApplicationForm, fiber.MIMEApplicationXML, fiber.MIMEMultipartForm, fiber.MIMETextPlain}
+
+// FuzzSyncsPostProgress pushes arbitrary bodies, which must be stored or rejected as client error but never fail the server
+func FuzzSyncsPostProgress(f *testing.F) {
+	seeds := []struct {
+		contentType int
+		body        string
+	}{
+		{0, `{"document":"0123456789abcdef0123456789abcdef","percentage":0.5,"progress":"/body/p[1]","device":"Kobo","device_id":"ID1"}`},
+		{0, `{"document":"0123456789abcdef0123456789abcdef","percentage":1e400,"progress":"p","device":"d","device_id":"i"}`},
+		{0, `{"document":"../0123456789abcdef0123456789abc","percentage":-1}`},
+		{0, `{"document":null,"percentage":"0.5","progress":[],"device":{}}`},
+		{0, `[{"document":"0123456789abcdef0123456789abcdef"}]`},
+		{0, `{"document":"0123456789abcdef0123456789abcdef","percentage":0.5,"progress":"\u0000","device":"\ud800","device_id":"i"}`},
+		{0, `{`},
+		{0, ``},
+		{1, `document=0123456789abcdef0123456789abcdef&percentage=NaN&progress=p&device=d&device_id=i`},
+		{1, `document=0123456789abcdef0123456789abcdef&percentage=0.25&progress=p&device=d&device_id=i`},
+		{2, `<DocumentData><Document>0123456789abcdef0123456789abcdef</Document></DocumentData>`},
+		{3, `--x--`},
+		{4, `percentage=0.5`},
+	}
+	for _, seed := range seeds {
+		f.Add(uint8(seed.contentType), []byte(seed.body))
+	}
+
+	app := newTestApp(f)
+	addTestUser(app, "", "alice")
+	fiberApp := fiber.New()
+	fiberApp.Use(app.NewAuthMiddleware())
+	fiberApp.Put("/syncs/progress", app.SyncsPostProgress)
+
+	f.Fuzz(func(t *testing.T, contentTypeIndex uint8, body []byte) {
+		contentType := syncsContentTypes[int(contentTypeIndex)%len(syncsContentTypes)]
+		req := httptest.NewRequest(fiber.MethodPut, "/syncs/progress", bytes.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, contentType)
+		req.Header.Set("x-auth-user", "alice")
+		req.Header.Set("x-auth-key", testUserKey)
+		resp, err := fiberApp.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != fiber.StatusOK && (resp.StatusCode < 400 || resp.StatusCode > 499) {
+			t.Errorf("status is %d for %q with %q", resp.StatusCode, body, contentType)
+		}
+	})
+}
+
+// TestSyncsPostProgressDocumentLimit pushes new documents in parallel, which must not exceed max_documents together
+func TestSyncsPostProgressDocumentLimit(t *testing.T) {
+	app := newTestApp(t)
+	app.Db.Config.Limits.MaxDocuments = 5
+	addTestUser(app, "", "alice")
+	fiberApp := fiber.New()
+	fiberApp.Use(app.NewAuthMiddleware())
+	fiberApp.Put("/syncs/progress", app.SyncsPostProgress)
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"document":"%032x","percentage":0.5,"progress":"p","device":"d"}`, i)
+			req := httptest.NewRequest(fiber.MethodPut, "/syncs/progress", strings.NewReader(body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			req.Header.Set("x-auth-user", "alice")
+			req.Header.Set("x-auth-key", testUserKey)
+			resp, err := fiberApp.Test(req, -1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != fiber.StatusOK && resp.StatusCode != fiber.StatusForbidden {
+				t.Errorf("status is %d", resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if documents := len(app.Db.Users["alice"].Documents); documents != 5 {
+		t.Errorf("alice has %d documents", documents)
+	}
+}
+
+func TestSyncsPostProgressMetrics(t *testing.T) {
+	app := newTestApp(t)
+	addTestUser(app, "", "alice")
+	fiberApp := fiber.New()
+	fiberApp.Use(app.NewAuthMiddleware())
+	fiberApp.Put("/syncs/progress", app.SyncsPostProgress)
+	push := func() {
+		body := `{"document":"0123456789abcdef0123456789abcdef","percentage":0.5,"progress":"p","device":"Kobo"}`
+		req := httptest.NewRequest(fiber.MethodPut, "/syncs/progress", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		req.Header.Set("x-auth-user", "alice")
+		req.Header.Set("x-auth-key", testUserKey)
+		resp, err := fiberApp.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+	}
+	count := func(counter *counterVec, labels string) float64 {
+		counter.lock.Lock()
+		defer counter.lock.Unlock()
+		return counter.values[labels]
+	}
+	const aliceLabels = `{user="alice",device="Kobo"}`
+
+	// Without a separate metrics address only the unlabelled total counts
+	total, perUser := count(progressPushesTotal, ""), count(userProgressPushesTotal, aliceLabels)
+	push()
+	if count(progressPushesTotal, "") != total+1 || count(userProgressPushesTotal, aliceLabels) != perUser {
+		t.Error("the push was not counted only in the total")
+	}
+
+	app.Db.Config.MetricsAddress = "127.0.0.1:9090"
+	push()
+	if count(progressPushesTotal, "") != total+2 || count(userProgressPushesTotal, aliceLabels) != perUser+1 {
+		t.Error("the push was not counted in the total and per user")
+	}
+}
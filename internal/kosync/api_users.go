@@ -8,17 +8,28 @@ package kosync
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func (app *Kosync) UsersAuth(c *fiber.Ctx) error {
-	app.PrintDebug("Users", c.Locals("requestid").(string), fmt.Sprintf("Login of user '%s'", c.Locals("current_user").(string)))
+	app.RequestLogger(c, "Users").Debug("Login")
+	app.Audit(c, AuditLoginSucceeded, c.Locals("current_user").(string), map[string]string{"method": "key"})
 	return c.SendStatus(fiber.StatusOK)
 }
 
 func (app *Kosync) UsersCreate(c *fiber.Ctx) error {
-	if app.Db.Config.DisableRegistration {
+	// Tenants have their own registration policy
+	tenantId := CurrentTenant(c)
+	app.LockDb()
+	tenant, _ := app.Db.FindTenant(tenantId)
+	disableRegistration := app.Db.Config.DisableRegistration
+	app.DbLock.Unlock()
+	if len(tenantId) > 0 {
+		disableRegistration = tenant.DisableRegistration
+	}
+	if disableRegistration {
 		return fiber.ErrPaymentRequired // KORSS also returns 402
 	}
 
@@ -31,10 +42,15 @@ func (app *Kosync) UsersCreate(c *fiber.Ctx) error {
 		return err
 	}
 
-	app.PrintDebug("Users", c.Locals("requestid").(string), fmt.Sprintf("Signup of new user '%s'", data.Username))
-	if err := app.AddUser(data.Username, data.Password); err != nil {
+	if app.TenantsConfigured() && strings.Contains(data.Username, TenantSeparator) {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("username must not contain '%s'", TenantSeparator))
+	}
+
+	app.RequestLogger(c, "Users").Debug("Signup of new user", "username", data.Username, "tenant", tenantId)
+	if err := app.AddUser(tenantId, data.Username, data.Password); err != nil {
 		return err
 	}
+	app.Audit(c, AuditUserRegistered, UserKey(tenantId, data.Username), nil)
 
 	return c.SendStatus(fiber.StatusCreated)
 }
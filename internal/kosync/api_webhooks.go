@@ -0,0 +1,75 @@
+//
+// File:        internal/kosync/api_webhooks.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const WebhookDeliveriesLimit = 100
+
+func (app *Kosync) ApiGetWebhooks(c *fiber.Ctx) error {
+	app.LockDb()
+	user, found := app.Db.Users[c.Locals("current_user").(string)]
+	webhooks := slices.Clone(user.Webhooks)
+	app.DbLock.Unlock()
+	if !found {
+		return fiber.ErrNotFound
+	}
+
+	if webhooks == nil {
+		webhooks = make([]WebhookData, 0)
+	}
+	return c.JSON(webhooks)
+}
+
+func (app *Kosync) ApiPutWebhooks(c *fiber.Ctx) error {
+	var webhooks []WebhookData
+	if err := c.BodyParser(&webhooks); err != nil {
+		return err
+	}
+	if webhooks == nil {
+		webhooks = make([]WebhookData, 0)
+	}
+
+	for _, webhook := range webhooks {
+		target, err := url.Parse(webhook.Url)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || len(target.Host) == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid webhook url '%s'", webhook.Url))
+		}
+		// Hostnames are checked when delivering, as they can resolve to other addresses later
+		if ip, err := netip.ParseAddr(target.Hostname()); err == nil && !IsPublicAddress(ip) {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("webhook url '%s' is not a public address", webhook.Url))
+		}
+		for _, event := range webhook.Events {
+			if !slices.Contains(WebhookEvents, event) {
+				return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("unknown webhook event '%s'", event))
+			}
+		}
+	}
+
+	username := c.Locals("current_user").(string)
+	app.RequestLogger(c, "Webhooks").Debug("Updated webhooks", "count", len(webhooks))
+	if err := app.UpdateUserWebhooks(username, webhooks); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (app *Kosync) ApiGetWebhookDeliveries(c *fiber.Ctx) error {
+	deliveries, err := app.ReadWebhookDeliveries(c.Locals("current_user").(string), WebhookDeliveriesLimit)
+	if err != nil {
+		return err
+	}
+	return c.JSON(deliveries)
+}
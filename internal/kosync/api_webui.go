@@ -9,6 +9,9 @@ package kosync
 import (
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -17,48 +20,171 @@ type UiDocumentData struct {
 	Id string `json:"id"`
 	FileData
 	History []FileData `json:"history"`
+	Aliases []string   `json:"aliases"`
+}
+
+type UiDocumentMerge struct {
+	Document string   `json:"document"`
+	Aliases  []string `json:"aliases"`
+}
+
+type UiDocumentMetadata struct {
+	Document string           `json:"document"`
+	Metadata DocumentMetadata `json:"metadata"`
 }
 
 func (app *Kosync) ApiGetDocumentsAll(c *fiber.Ctx) error {
+	app.LockDb()
 	data, found := app.Db.Users[c.Locals("current_user").(string)]
 	if !found {
+		app.DbLock.Unlock()
 		return fiber.ErrNotFound
 	}
 
+	aliases := make(map[string][]string)
+	for alias, canonical := range data.Aliases {
+		aliases[canonical] = append(aliases[canonical], alias)
+	}
+
 	result := make([]UiDocumentData, 0, len(data.Documents))
 	for id, doc := range data.Documents {
+		docAliases, found := aliases[id]
+		if !found {
+			docAliases = make([]string, 0)
+		}
 		history, found := data.History[doc.DocumentId]
 		if !found {
-			result = append(result, UiDocumentData{id, doc, make([]FileData, 0)})
+			result = append(result, UiDocumentData{id, doc, make([]FileData, 0), docAliases})
 		} else {
-			result = append(result, UiDocumentData{id, doc, history.DocumentHistory})
+			result = append(result, UiDocumentData{id, doc, slices.Clone(history.DocumentHistory), docAliases})
 		}
 	}
+	app.DbLock.Unlock()
 
 	c.Set("Access-Control-Allow-Origin", "*")
 	return c.JSON(result)
 }
 
 func (app *Kosync) ApiPutDocument(c *fiber.Ctx) error {
+	limits := app.CurrentLimits()
+	if err := limits.CheckBody(c); err != nil {
+		return err
+	}
+
 	var document UiDocumentData
 	if err := c.BodyParser(&document); err != nil {
 		return err
 	}
 
-	if err := app.UpdateDocumentPrettyName(c.Locals("current_user").(string), document.DocumentId, document.PrettyName); err != nil {
+	if err := limits.CheckField("pretty_name", document.PrettyName); err != nil {
+		return err
+	}
+	username := c.Locals("current_user").(string)
+
+	if err := app.UpdateDocumentPrettyName(username, document.DocumentId, document.PrettyName); err != nil {
 		return err
 	}
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
+func (app *Kosync) ApiPutDocumentMetadata(c *fiber.Ctx) error {
+	var data UiDocumentMetadata
+	if err := c.BodyParser(&data); err != nil {
+		return err
+	}
+
+	username := c.Locals("current_user").(string)
+	if !app.HasDocument(username, data.Document) {
+		return fiber.ErrNotFound
+	}
+
+	switch data.Metadata.Status {
+	case DocumentStatusReading, DocumentStatusFinished, DocumentStatusAbandoned:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("unknown document status '%s'", data.Metadata.Status))
+	}
+	data.Metadata.Title = strings.TrimSpace(data.Metadata.Title)
+	data.Metadata.Series = strings.TrimSpace(data.Metadata.Series)
+	data.Metadata.CoverUrl = strings.TrimSpace(data.Metadata.CoverUrl)
+	data.Metadata.Authors = normalizeList(data.Metadata.Authors)
+	data.Metadata.Tags = normalizeList(data.Metadata.Tags)
+
+	app.RequestLogger(c, "WebUI").Debug("Updated document metadata", "document", data.Document)
+	if err := app.UpdateDocumentMetadata(username, data.Document, data.Metadata); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (app *Kosync) ApiPutDocumentMerge(c *fiber.Ctx) error {
+	var data UiDocumentMerge
+	if err := c.BodyParser(&data); err != nil {
+		return err
+	}
+
+	username := c.Locals("current_user").(string)
+	if !app.HasDocument(username, data.Document) {
+		return fiber.ErrNotFound
+	}
+
+	app.RequestLogger(c, "WebUI").Debug("Merged documents", "document", data.Document, "aliases", data.Aliases)
+	aliases := normalizeList(data.Aliases)
+	if err := app.MergeDocuments(username, data.Document, aliases); err != nil {
+		return err
+	}
+	app.Audit(c, AuditDocumentMerged, username, map[string]string{"document": data.Document, "aliases": strings.Join(aliases, ",")})
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (app *Kosync) ApiPutDocumentUnmerge(c *fiber.Ctx) error {
+	var data UiDocumentMerge
+	if err := c.BodyParser(&data); err != nil {
+		return err
+	}
+
+	username := c.Locals("current_user").(string)
+	app.LockDb()
+	_, found := app.Db.Users[username].Aliases[data.Document]
+	app.DbLock.Unlock()
+	if !found {
+		return fiber.ErrNotFound
+	}
+
+	app.RequestLogger(c, "WebUI").Debug("Unmerged document", "document", data.Document)
+	if err := app.UnmergeDocument(username, data.Document); err != nil {
+		return err
+	}
+	app.Audit(c, AuditDocumentUnmerged, username, map[string]string{"document": data.Document})
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// normalizeList trims all entries and removes empty and duplicate ones
+func normalizeList(list []string) []string {
+	result := make([]string, 0, len(list))
+	for _, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if len(entry) > 0 && !slices.Contains(result, entry) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
 func (app *Kosync) ApiAuthBasic(c *fiber.Ctx) error {
-	user := app.Db.Users[c.Locals("current_user").(string)]
+	userId := UserKey(CurrentTenant(c), c.Locals("current_user").(string))
+	app.LockDb()
+	user := app.Db.Users[userId]
+	app.DbLock.Unlock()
+	app.Audit(c, AuditLoginSucceeded, userId, map[string]string{"method": "basic"})
 	type UserData struct {
 		Username string `json:"username"`
 		Key      string `json:"key"`
 	}
 	bytes, _ := json.Marshal(UserData{user.Username, user.Password})
 	userObj := base64.StdEncoding.EncodeToString(bytes)
-	return c.Redirect("/web?user="+userObj, fiber.StatusTemporaryRedirect)
+	return c.Redirect(TenantPathPrefix(c)+"/web?user="+userObj, fiber.StatusTemporaryRedirect)
 }
@@ -0,0 +1,141 @@
+//
+// File:        internal/kosync/audit.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	AuditLogFile = "audit.log"
+
+	AuditUserRegistered    = "user.registered"
+	AuditUserDeleted       = "user.deleted"
+	AuditUserRenamed       = "user.renamed"
+	AuditPasswordChanged   = "user.password_changed"
+	AuditLoginSucceeded    = "login.succeeded"
+	AuditLoginFailed       = "login.failed"
+	AuditDocumentMerged    = "document.merged"
+	AuditDocumentUnmerged  = "document.unmerged"
+	AuditDocumentDeleted   = "document.deleted"
+	AuditAdminChanged      = "user.admin_changed"
+	AuditDatabaseRestored  = "database.restored"
+	AuditBackupCreated     = "backup.created"
+	AuditAdminAction       = "admin.action"
+	AuditDefaultQueryLimit = 100
+
+	// AuditDeletedUserPrefix starts the pseudonyms that replace the usernames of deleted users in the audit log
+	AuditDeletedUserPrefix = "deleted:"
+)
+
+type AuditEntry struct {
+	Timestamp int64             `json:"timestamp"`
+	Event     string            `json:"event"`
+	Username  string            `json:"username,omitempty"` // User the event is about
+	RequestId string            `json:"request_id,omitempty"`
+	Ip        string            `json:"ip,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+type AuditQuery struct {
+	Username string
+	Event    string
+	Since    int64
+	Until    int64
+	Limit    int
+}
+
+// Audit appends an entry to the audit log next to the database, c is nil for events outside of requests
+func (app *Kosync) Audit(c *fiber.Ctx, event, username string, details map[string]string) {
+	entry := AuditEntry{
+		Timestamp: time.Now().Unix(),
+		Event:     event,
+		Username:  username,
+		Details:   details,
+	}
+	if c != nil {
+		entry.RequestId, _ = c.Locals("requestid").(string)
+		entry.Ip = c.IP()
+		entry.UserAgent = c.Get(fiber.HeaderUserAgent)
+	}
+
+	app.AuditLock.Lock()
+	defer app.AuditLock.Unlock()
+	if err := appendJsonLine(filepath.Join(filepath.Dir(app.DbFile), AuditLogFile), entry); err != nil {
+		app.Logger("Audit").Error("Failed to write audit log", "event", event, "error", err)
+	}
+}
+
+// ReplaceAuditUsername replaces the username in the entries about the user and in details naming the user
+func (app *Kosync) ReplaceAuditUsername(username, replacement string) error {
+	app.AuditLock.Lock()
+	defer app.AuditLock.Unlock()
+
+	return rewriteJsonLines(filepath.Join(filepath.Dir(app.DbFile), AuditLogFile), func(line []byte) ([]byte, error) {
+		var entry AuditEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, err
+		}
+		replaced := false
+		if entry.Username == username {
+			entry.Username = replacement
+			replaced = true
+		}
+		for key, value := range entry.Details {
+			if value == username {
+				entry.Details[key] = replacement
+				replaced = true
+			}
+		}
+		if !replaced {
+			return line, nil
+		}
+		return json.Marshal(entry)
+	})
+}
+
+// newAuditPseudonym returns a name for a deleted user that is never given to another user
+func newAuditPseudonym() string {
+	return AuditDeletedUserPrefix + rand.Text()
+}
+
+// QueryAudit returns the matching entries of the audit log, newest first
+func (app *Kosync) QueryAudit(query AuditQuery) ([]AuditEntry, error) {
+	app.AuditLock.Lock()
+	defer app.AuditLock.Unlock()
+
+	result := make([]AuditEntry, 0)
+	err := readJsonLines(filepath.Join(filepath.Dir(app.DbFile), AuditLogFile), func(line []byte) error {
+		var entry AuditEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+		if (len(query.Username) == 0 || entry.Username == query.Username) &&
+			(len(query.Event) == 0 || entry.Event == query.Event) &&
+			(query.Since == 0 || entry.Timestamp >= query.Since) &&
+			(query.Until == 0 || entry.Timestamp <= query.Until) {
+			result = append(result, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(result)
+	if query.Limit > 0 && len(result) > query.Limit {
+		result = result[:query.Limit]
+	}
+	return result, nil
+}
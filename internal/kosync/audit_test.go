@@ -0,0 +1,157 @@
+//
+// File:        internal/kosync/audit_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newTestLogApp returns an app with the users alice and bob and audit entries and webhook deliveries of both
+func newTestLogApp(t *testing.T) *Kosync {
+	app := newTestApp(t)
+	addTestUser(app, "", "alice")
+	addTestUser(app, "", "bob")
+	app.Audit(nil, AuditUserRegistered, "alice", nil)
+	app.Audit(nil, AuditLoginFailed, "", map[string]string{"reason": "unknown_user", "username": "alice"})
+	app.Audit(nil, AuditUserRegistered, "bob", nil)
+	app.Audit(nil, AuditAdminAction, "bob", map[string]string{"path": "/api/users", "by": "alice"})
+	app.logWebhookDelivery(WebhookDeliveryData{Id: "1", Event: WebhookEventProgress, Username: "alice"})
+	app.logWebhookDelivery(WebhookDeliveryData{Id: "2", Event: WebhookEventProgress, Username: "bob"})
+	app.logWebhookDelivery(WebhookDeliveryData{Id: "3", Event: WebhookEventBackupCreated})
+	return app
+}
+
+func queryAuditOf(t *testing.T, app *Kosync, username string) []AuditEntry {
+	t.Helper()
+	entries, err := app.QueryAudit(AuditQuery{Username: username})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestDeleteUserPseudonymizesLogs(t *testing.T) {
+	app := newTestLogApp(t)
+	pseudonym, err := app.DeleteUser("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(pseudonym, AuditDeletedUserPrefix) {
+		t.Errorf("pseudonym is %q", pseudonym)
+	}
+
+	// A new user with the same name starts without entries
+	if entries := queryAuditOf(t, app, "alice"); len(entries) != 0 {
+		t.Errorf("audit log still has entries of the deleted user: %+v", entries)
+	}
+	if entries := queryAuditOf(t, app, pseudonym); len(entries) != 1 || entries[0].Event != AuditUserRegistered {
+		t.Errorf("entries of the pseudonym are %+v", entries)
+	}
+	all := queryAuditOf(t, app, "")
+	if len(all) != 4 {
+		t.Fatalf("audit log has %d entries, expected 4", len(all))
+	}
+	for _, entry := range all {
+		for key, value := range entry.Details {
+			if value == "alice" {
+				t.Errorf("detail %q of %s still names the deleted user", key, entry.Event)
+			}
+		}
+	}
+
+	if entries := queryAuditOf(t, app, "bob"); len(entries) != 2 {
+		t.Errorf("entries of other users are %+v", entries)
+	}
+	if deliveries, err := app.ReadWebhookDeliveries("alice", 0); err != nil || len(deliveries) != 0 {
+		t.Errorf("deliveries of the deleted user are %+v, %v", deliveries, err)
+	}
+	if deliveries, err := app.ReadWebhookDeliveries("bob", 0); err != nil || len(deliveries) != 1 {
+		t.Errorf("deliveries of other users are %+v, %v", deliveries, err)
+	}
+	if deliveries, err := app.ReadWebhookDeliveries("", 0); err != nil || len(deliveries) != 1 {
+		t.Errorf("deliveries of global webhooks are %+v, %v", deliveries, err)
+	}
+}
+
+func TestDeleteUserWithoutLogs(t *testing.T) {
+	app := newTestApp(t)
+	addTestUser(app, "", "alice")
+	if _, err := app.DeleteUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.DeleteUser("alice"); err == nil {
+		t.Error("deleting a missing user succeeded")
+	}
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(app.DbFile), "*.log"))
+	if len(matches) != 0 {
+		t.Errorf("deleting created the logs %v", matches)
+	}
+}
+
+func TestRenameUserMovesLogs(t *testing.T) {
+	app := newTestLogApp(t)
+	if err := app.RenameUser("alice", "carol"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new user with the old name starts without entries
+	if entries := queryAuditOf(t, app, "alice"); len(entries) != 0 {
+		t.Errorf("audit log still has entries of the old username: %+v", entries)
+	}
+	if entries := queryAuditOf(t, app, "carol"); len(entries) != 1 || entries[0].Event != AuditUserRegistered {
+		t.Errorf("entries of the new username are %+v", entries)
+	}
+	if entries := queryAuditOf(t, app, "bob"); len(entries) != 2 || entries[0].Details["by"] != "carol" {
+		t.Errorf("entries of other users are %+v", entries)
+	}
+	if deliveries, err := app.ReadWebhookDeliveries("alice", 0); err != nil || len(deliveries) != 0 {
+		t.Errorf("deliveries of the old username are %+v, %v", deliveries, err)
+	}
+	if deliveries, err := app.ReadWebhookDeliveries("carol", 0); err != nil || len(deliveries) != 1 || deliveries[0].Id != "1" {
+		t.Errorf("deliveries of the new username are %+v, %v", deliveries, err)
+	}
+}
+
+func TestRestoreAuditsDeletedDocuments(t *testing.T) {
+	const documentId = "0123456789abcdef0123456789abcdef"
+	app := newTestApp(t)
+	addTestUser(app, "", "alice")
+	alice := app.Db.Users["alice"]
+	alice.IsAdmin = true
+	app.Db.Users["alice"] = alice
+	backup := testBackup(t, app.Db)
+	app.Db.Users["alice"].Documents[documentId] = FileData{ProgressData: ProgressData{Percentage: 0.5, Progress: "p", Device: "d"}, DocumentId: documentId}
+
+	fiberApp := fiber.New()
+	fiberApp.Use(app.NewAuthMiddleware())
+	fiberApp.Post("/api/backups.restore", app.RequireAdmin, app.ApiPostBackupRestore)
+	req := httptest.NewRequest(fiber.MethodPost, "/api/backups.restore", bytes.NewReader(backup))
+	req.Header.Set("x-auth-user", "alice")
+	req.Header.Set("x-auth-key", testUserKey)
+	resp, err := fiberApp.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status is %d", resp.StatusCode)
+	}
+
+	entries, err := app.QueryAudit(AuditQuery{Event: AuditDocumentDeleted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Username != "alice" || entries[0].Details["document"] != documentId {
+		t.Errorf("audit entries of deleted documents are %+v", entries)
+	}
+}
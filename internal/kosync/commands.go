@@ -0,0 +1,130 @@
+//
+// File:        internal/kosync/commands.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// RunCommand executes the subcommand and returns the exit code of the process
+func RunCommand(name string, args []string) int {
+	switch name {
+	case "healthcheck":
+		return CommandHealthcheck(args)
+	case "backup":
+		return CommandBackup(args)
+	case "migrate":
+		return CommandMigrate(args)
+	case "export":
+		return CommandExport(args)
+	case "import":
+		return CommandImport(args)
+	case "user":
+		return CommandUser(args)
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "Unknown command '%s'. Available commands: healthcheck, backup, migrate, export, import, user\n", name)
+		return 2
+	}
+}
+
+// CommandHealthcheck queries /readyz of the running server, meant for the Docker HEALTHCHECK
+func CommandHealthcheck(args []string) int {
+	flags := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	url := flags.String("url", "", "URL of the readiness endpoint, defaults to /readyz on the configured listen_address")
+	insecure := flags.Bool("insecure", false, "Do not verify the TLS certificate of the server")
+	_ = flags.Parse(args)
+
+	serverName := ""
+	if len(*url) == 0 {
+		config, err := ReadConfig()
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Failed to read the config: %v\n", err)
+			return 1
+		}
+		scheme := "http"
+		if config.Tls.Enabled() {
+			// The certificate is issued for the public domain and not for the local address
+			scheme = "https"
+			*insecure = true
+			// ACME certificates are only served for the requested domains
+			if len(config.Tls.Acme.Domains) > 0 {
+				serverName = config.Tls.Acme.Domains[0]
+			}
+		}
+		*url = fmt.Sprintf("%s://%s/readyz", scheme, localAddress(config.ListenAddress))
+	}
+
+	client := http.Client{Timeout: 5 * time.Second}
+	if *insecure {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, ServerName: serverName}}
+	}
+	resp, err := client.Get(*url)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Healthcheck failed: %v\n", err)
+		return 1
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var health HealthData
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Healthcheck returned an invalid response: %v\n", err)
+		return 1
+	}
+	for name, check := range health.Checks {
+		if !check.Ok {
+			_, _ = fmt.Fprintf(os.Stderr, "Check '%s' failed: %s\n", name, check.Message)
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		_, _ = fmt.Fprintf(os.Stderr, "Healthcheck failed with status '%s'\n", health.Status)
+		return 1
+	}
+
+	fmt.Printf("KOsync v%s is %s\n", health.Version, health.Status)
+	return 0
+}
+
+// loadCommandDatabase loads the existing database for commands, unlike the server it never creates a new one
+func loadCommandDatabase() (*Kosync, error) {
+	found, dbFile, err := FindDatabaseFile()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("no database found at '%s'", dbFile)
+	}
+	_, db, err := LoadOrInitDatabase()
+	if err != nil {
+		return nil, err
+	}
+	koapp := &Kosync{Db: db, DbFile: dbFile}
+	if err := koapp.ConfigureLogging(); err != nil {
+		return nil, err
+	}
+	return koapp, nil
+}
+
+// localAddress turns a listen address like ":8080" or "0.0.0.0:8080" into an address reachable from this host
+func localAddress(listenAddress string) string {
+	host, port, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return listenAddress
+	}
+	if len(host) == 0 || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
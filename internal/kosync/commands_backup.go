@@ -0,0 +1,149 @@
+//
+// File:        internal/kosync/commands_backup.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// CommandBackup dispatches "kosync backup <verify|inspect> <file>"
+func CommandBackup(args []string) int {
+	if len(args) == 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "Usage: kosync backup <verify|inspect> <file>")
+		return 2
+	}
+
+	switch args[0] {
+	case "verify":
+		return CommandBackupVerify(args[1:])
+	case "inspect":
+		return CommandBackupInspect(args[1:])
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "Unknown backup command '%s'. Available commands: verify, inspect\n", args[0])
+		return 2
+	}
+}
+
+// CommandBackupVerify checks that a backup file is intact and can be restored by this version
+func CommandBackupVerify(args []string) int {
+	flags := flag.NewFlagSet("backup verify", flag.ExitOnError)
+	keyFile := flags.String("key-file", "", "File with the passphrase of encrypted backups, defaults to backup_key_file of the config")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		_, _ = fmt.Fprintln(os.Stderr, "Usage: kosync backup verify [--key-file <file>] <file>")
+		return 2
+	}
+
+	db, err := readBackupFile(flags.Arg(0), *keyFile)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Backup is invalid: %v\n", err)
+		return 1
+	}
+	if db.Schema > SchemaVersion {
+		_, _ = fmt.Fprintf(os.Stderr, "Backup has schema version %d, this version of KOsync only supports up to %d\n", db.Schema, SchemaVersion)
+		return 1
+	}
+
+	fmt.Printf("Backup '%s' is valid\n", flags.Arg(0))
+	return 0
+}
+
+// CommandBackupInspect prints the headers and a summary of the contents of a backup file
+func CommandBackupInspect(args []string) int {
+	flags := flag.NewFlagSet("backup inspect", flag.ExitOnError)
+	keyFile := flags.String("key-file", "", "File with the passphrase of encrypted backups, defaults to backup_key_file of the config")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		_, _ = fmt.Fprintln(os.Stderr, "Usage: kosync backup inspect [--key-file <file>] <file>")
+		return 2
+	}
+
+	config, err := ReadConfig()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Failed to read the config: %v\n", err)
+		return 1
+	}
+	backupData, err := ReadBackup(flags.Arg(0), config)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Failed to read the backup: %v\n", err)
+		return 1
+	}
+	block, err := DecodeBackupBlock(backupData)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Backup is invalid: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("File:      %s\n", flags.Arg(0))
+	fmt.Printf("Type:      %s\n", block.Type)
+	fmt.Printf("Size:      %d bytes\n", len(block.Bytes))
+	fmt.Println("Headers:")
+	headers := make([]string, 0, len(block.Headers))
+	for name := range block.Headers {
+		headers = append(headers, name)
+	}
+	sort.Strings(headers)
+	for _, name := range headers {
+		fmt.Printf("  %s: %s\n", name, block.Headers[name])
+	}
+	if _, found := block.Headers["Checksum"]; !found {
+		fmt.Println("Warning: The backup has no checksum, it was created by an older version of KOsync")
+	}
+
+	passphrase, err := backupCommandPassphrase(config, *keyFile)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Failed to read the passphrase: %v\n", err)
+		return 1
+	}
+	db, err := DecodeBackupPayload(block, passphrase)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Failed to decode the backup: %v\n", err)
+		return 1
+	}
+
+	documents, history := 0, 0
+	for _, user := range db.Users {
+		documents += len(user.Documents)
+		for _, entry := range user.History {
+			history += len(entry.DocumentHistory)
+		}
+	}
+	fmt.Printf("Schema:    %d\n", db.Schema)
+	fmt.Printf("Users:     %d\n", len(db.Users))
+	fmt.Printf("Documents: %d\n", documents)
+	fmt.Printf("History:   %d entries\n", history)
+	return 0
+}
+
+// readBackupFile reads and fully decodes a backup file without touching the database
+func readBackupFile(reference, keyFile string) (Database, error) {
+	config, err := ReadConfig()
+	if err != nil {
+		return Database{}, err
+	}
+	backupData, err := ReadBackup(reference, config)
+	if err != nil {
+		return Database{}, err
+	}
+	passphrase, err := backupCommandPassphrase(config, keyFile)
+	if err != nil {
+		return Database{}, err
+	}
+	db, _, err := DecodeBackup(backupData, passphrase)
+	return db, err
+}
+
+// backupCommandPassphrase resolves the passphrase like the server does, a key file given on the command line wins over the config
+func backupCommandPassphrase(config ConfigData, keyFile string) (string, error) {
+	if len(keyFile) > 0 {
+		config.BackupKeyFile = keyFile
+	}
+	return BackupPassphrase(config)
+}
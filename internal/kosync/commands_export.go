@@ -0,0 +1,117 @@
+//
+// File:        internal/kosync/commands_export.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// CommandExport writes the database in a portable format to stdout or a file
+func CommandExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "", "One of jsonl, csv or redis, defaults to the extension of --output or jsonl")
+	output := flags.String("output", "", "File to write the export to, defaults to stdout")
+	_ = flags.Parse(args)
+	if len(*format) == 0 {
+		*format = ExportFormatOfFile(*output)
+	}
+
+	koapp, err := loadCommandDatabase()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Failed to load the database: %v\n", err)
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if len(*output) > 0 {
+		// bearer:disable go_gosec_filesystem_filereadtaint
+		file, err := os.OpenFile(*output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Failed to create the export file: %v\n", err)
+			return 1
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		w = file
+	}
+
+	buffered := bufio.NewWriter(w)
+	if err := WriteExport(buffered, ExportRecords(koapp.Db), *format); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+		return 1
+	}
+	if err := buffered.Flush(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// CommandImport merges an export into the database, the server must not run while importing
+func CommandImport(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "One of jsonl, csv, redis or rdb, defaults to the extension of the file or jsonl")
+	redis := flags.String("redis", "", "Reads the data of the KOReader sync server from a Redis server like redis://localhost:6379/0 instead of a file")
+	dryRun := flags.Bool("dry-run", false, "Print what would be imported without writing the database")
+	_ = flags.Parse(args)
+	if (len(*redis) > 0 && flags.NArg() != 0) || (len(*redis) == 0 && flags.NArg() != 1) {
+		_, _ = fmt.Fprintln(os.Stderr, "Usage: kosync import [--format <jsonl|csv|redis|rdb>] [--dry-run] <file>")
+		_, _ = fmt.Fprintln(os.Stderr, "       kosync import --redis <redis://host:port/db> [--dry-run]")
+		return 2
+	}
+	if len(*format) == 0 {
+		*format = ExportFormatOfFile(flags.Arg(0))
+	}
+
+	koapp, err := loadCommandDatabase()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Failed to load the database: %v\n", err)
+		return 1
+	}
+
+	var records []ExportRecord
+	if len(*redis) > 0 {
+		records, err = ReadRedisRecords(*redis)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Failed to read from Redis: %v\n", err)
+			return 1
+		}
+	} else {
+		// bearer:disable go_gosec_filesystem_filereadtaint
+		file, err := os.Open(flags.Arg(0))
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Failed to open the import file: %v\n", err)
+			return 1
+		}
+		records, err = ReadImport(file, *format)
+		_ = file.Close()
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Failed to read the import file: %v\n", err)
+			return 1
+		}
+	}
+
+	result, err := koapp.ImportRecords(records, *dryRun)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Import failed: %v\n", err)
+		return 1
+	}
+	for _, warning := range result.Warnings {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	verb := "Imported"
+	if *dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d users, %d documents and %d history entries, skipped %d records\n", verb, result.Users, result.Documents, result.History, result.Skipped)
+	return 0
+}
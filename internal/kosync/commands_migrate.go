@@ -0,0 +1,129 @@
+//
+// File:        internal/kosync/commands_migrate.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// CommandMigrate dispatches "kosync migrate <status|up|down>", the server must not run while migrating
+func CommandMigrate(args []string) int {
+	if len(args) == 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "Usage: kosync migrate <status|up|down> [--to <version>] [--dry-run]")
+		return 2
+	}
+
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	target := flags.Int("to", -1, "Schema version to migrate to, defaults to the latest for up and the previous for down")
+	dryRun := flags.Bool("dry-run", false, "Print the changes of the migrations without writing the database")
+	_ = flags.Parse(args[1:])
+
+	koapp, err := loadCommandDatabase()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Failed to load the database: %v\n", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "status":
+		return koapp.commandMigrateStatus()
+	case "up":
+		if *target < 0 {
+			*target = SchemaVersion
+		}
+		if *target < koapp.Db.Schema {
+			_, _ = fmt.Fprintf(os.Stderr, "The database already has schema %d, use 'kosync migrate down' to revert migrations\n", koapp.Db.Schema)
+			return 1
+		}
+	case "down":
+		if *target < 0 {
+			*target = koapp.Db.Schema - 1
+		}
+		if *target > koapp.Db.Schema {
+			_, _ = fmt.Fprintf(os.Stderr, "The database has schema %d, use 'kosync migrate up' to apply migrations\n", koapp.Db.Schema)
+			return 1
+		}
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "Unknown migrate command '%s'. Available commands: status, up, down\n", args[0])
+		return 2
+	}
+
+	if *target == koapp.Db.Schema {
+		fmt.Printf("The database already has schema %d\n", koapp.Db.Schema)
+		return 0
+	}
+	if *dryRun {
+		if err := koapp.MigrationDryRun(*target); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if _, err := koapp.BackupDatabase(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Failed to create a backup: %v\n", err)
+		return 1
+	}
+	from := koapp.Db.Schema
+	if err := koapp.MigrateSchemaTo(*target); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Migration failed at schema %d: %v\n", koapp.Db.Schema, err)
+		return 1
+	}
+	fmt.Printf("Migrated the database from schema %d to %d\n", from, koapp.Db.Schema)
+	return 0
+}
+
+// MigrationDryRun migrates the loaded database in memory and prints the migrations and the changes to the database file
+func (app *Kosync) MigrationDryRun(target int) error {
+	// bearer:disable go_gosec_filesystem_filereadtaint
+	before, err := os.ReadFile(app.DbFile)
+	if err != nil {
+		return err
+	}
+
+	from := app.Db.Schema
+	err = MigrateDatabase(&app.Db, target, func(migration Migration, from, to int) error {
+		fmt.Printf("Migration %d: %s (schema %d -> %d)\n", migration.Version, migration.Name, from, to)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	after, err := json.Marshal(app.Db)
+	if err != nil {
+		return err
+	}
+	changes, err := DiffJson(before, after)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Migrating from schema %d to %d would make %d changes to %s:\n", from, app.Db.Schema, len(changes), app.DbFile)
+	for _, change := range changes {
+		fmt.Println(change.String())
+	}
+	return nil
+}
+
+func (app *Kosync) commandMigrateStatus() int {
+	fmt.Printf("Database: %s\n", app.DbFile)
+	fmt.Printf("Schema:   %d (latest %d)\n", app.Db.Schema, SchemaVersion)
+	for _, migration := range Migrations {
+		state := "pending"
+		if migration.Version <= app.Db.Schema {
+			state = "applied"
+		}
+		reversible := ""
+		if migration.Down == nil {
+			reversible = " (irreversible)"
+		}
+		fmt.Printf("  %3d %-8s %s%s\n", migration.Version, state, migration.Name, reversible)
+	}
+	return 0
+}
@@ -0,0 +1,89 @@
+//
+// File:        internal/kosync/commands_user.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// CommandUser dispatches "kosync user set-admin <username>"
+func CommandUser(args []string) int {
+	if len(args) == 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "Usage: kosync user set-admin [--tenant] [--revoke] <username>")
+		return 2
+	}
+
+	switch args[0] {
+	case "set-admin":
+		return CommandUserSetAdmin(args[1:])
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "Unknown user command '%s'. Available commands: set-admin\n", args[0])
+		return 2
+	}
+}
+
+// CommandUserSetAdmin grants or revokes the admin right of a user, the server must not run while the database is changed
+func CommandUserSetAdmin(args []string) int {
+	flags := flag.NewFlagSet("user set-admin", flag.ExitOnError)
+	tenant := flags.Bool("tenant", false, "Change is_tenant_admin, the admin right within the tenant of the user, instead of is_admin")
+	revoke := flags.Bool("revoke", false, "Revoke the admin right instead of granting it")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		_, _ = fmt.Fprintln(os.Stderr, "Usage: kosync user set-admin [--tenant] [--revoke] <username>")
+		return 2
+	}
+
+	koapp, err := loadCommandDatabase()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Failed to load the database: %v\n", err)
+		return 1
+	}
+	if err := koapp.SetUserAdmin(flags.Arg(0), *tenant, !*revoke); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Failed to change the admin right: %v\n", err)
+		return 1
+	}
+
+	field := "is_admin"
+	if *tenant {
+		field = "is_tenant_admin"
+	}
+	fmt.Printf("Set %s of '%s' to %t\n", field, flags.Arg(0), !*revoke)
+	return 0
+}
+
+// SetUserAdmin sets is_admin or, for tenantAdmin, is_tenant_admin of the user and records the change in the audit log
+func (app *Kosync) SetUserAdmin(userId string, tenantAdmin, admin bool) error {
+	app.LockDb()
+	defer app.DbLock.Unlock()
+
+	user, found := app.Db.Users[userId]
+	if !found {
+		return fmt.Errorf("user '%s' does not exist", userId)
+	}
+	field := "is_admin"
+	if tenantAdmin {
+		if len(user.Tenant) == 0 {
+			return fmt.Errorf("user '%s' does not belong to a tenant", userId)
+		}
+		field = "is_tenant_admin"
+		user.IsTenantAdmin = admin
+	} else {
+		user.IsAdmin = admin
+	}
+
+	previous := app.Db.Users[userId]
+	app.Db.Users[userId] = user
+	if err := app.PersistDatabase(); err != nil {
+		app.Db.Users[userId] = previous
+		return err
+	}
+	app.Audit(nil, AuditAdminChanged, userId, map[string]string{field: strconv.FormatBool(admin)})
+	return nil
+}
@@ -0,0 +1,50 @@
+//
+// File:        internal/kosync/commands_user_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestSetUserAdmin(t *testing.T) {
+	app := newTestApp(t)
+	addTestUser(app, "", "alice")
+	addTestUser(app, "family", "carol")
+
+	if err := app.SetUserAdmin("alice", false, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.SetUserAdmin("family/carol", true, true); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(app.DbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored Database
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if !stored.Users["alice"].IsAdmin || stored.Users["family/carol"].IsAdmin || !stored.Users["family/carol"].IsTenantAdmin {
+		t.Errorf("stored users are %+v and %+v", stored.Users["alice"], stored.Users["family/carol"])
+	}
+	if entries := queryAuditOf(t, app, "alice"); len(entries) != 1 || entries[0].Event != AuditAdminChanged || entries[0].Details["is_admin"] != "true" {
+		t.Errorf("audit entries are %+v", entries)
+	}
+
+	if err := app.SetUserAdmin("alice", false, false); err != nil || app.Db.Users["alice"].IsAdmin {
+		t.Errorf("revoking failed: %v", err)
+	}
+	if err := app.SetUserAdmin("alice", true, true); err == nil {
+		t.Error("a user outside of tenants became tenant admin")
+	}
+	if err := app.SetUserAdmin("mallory", false, true); err == nil {
+		t.Error("an unknown user became admin")
+	}
+}
@@ -7,10 +7,15 @@
 package kosync
 
 import (
+	// bearer:disable go_gosec_blocklist_md5
+	"crypto/md5"
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"time"
+
+	"github.com/gofiber/fiber/v2"
 )
 
 func FindDatabaseFile() (bool, string, error) {
@@ -69,15 +74,16 @@ func LoadOrInitDatabase() (string, Database, error) {
 
 	// Fallback to empty
 	if createEmptyDatabase {
-		db = Database{
-			Config: ConfigData{
-				ListenAddress:       ":8080",
-				DisableRegistration: false,
-				DebugLog:            false,
-				StoreHistory:        false,
-				BackupEncodingType:  "msgpack",
-			},
-			Users: make(map[string]UserData),
+		db, err = NewDatabase()
+		if err != nil {
+			return "", Database{}, err
+		}
+		data, err := json.MarshalIndent(db, "", "  ")
+		if err != nil {
+			return "", Database{}, err
+		}
+		if err := os.WriteFile(foundDbFile, data, 0600); err != nil {
+			return "", Database{}, err
 		}
 	}
 
@@ -89,61 +95,164 @@ func LoadOrInitDatabase() (string, Database, error) {
 	return foundDbFile, db, nil
 }
 
+// NewDatabase returns an empty database on the latest schema.
+// The limits only apply to new databases and not to migrated ones.
+func NewDatabase() (Database, error) {
+	db := Database{
+		Config: ConfigData{
+			ListenAddress:       ":8080",
+			DisableRegistration: false,
+			DebugLog:            false,
+			StoreHistory:        false,
+			BackupEncodingType:  "msgpack",
+			Webhooks:            make([]WebhookData, 0),
+			LogFormat:           LogFormatText,
+			LogLevel:            "info",
+			LogLevels:           make(map[string]string),
+		},
+		Users: make(map[string]UserData),
+	}
+	if err := MigrateDatabase(&db, SchemaVersion, nil); err != nil {
+		return Database{}, err
+	}
+	db.Config.Limits = DefaultLimits
+	return db, nil
+}
+
+// LockDb acquires the DbLock and records the time spent waiting for it
+func (app *Kosync) LockDb() {
+	start := time.Now()
+	app.DbLock.Lock()
+	databaseLockWaitDuration.Observe(time.Since(start).Seconds())
+}
+
+func databaseFileSize(dbFile string) (int64, error) {
+	stat, err := os.Stat(dbFile)
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+// ReadConfig reads the config from the database file without creating or migrating the database
+func ReadConfig() (ConfigData, error) {
+	found, dbFile, err := FindDatabaseFile()
+	if err != nil {
+		return ConfigData{}, err
+	}
+
+	var db Database
+	if found {
+		data, err := os.ReadFile(dbFile)
+		if err != nil {
+			return ConfigData{}, err
+		}
+		if err := json.Unmarshal(data, &db); err != nil {
+			return ConfigData{}, err
+		}
+	}
+
+	if len(db.Config.ListenAddress) == 0 {
+		db.Config.ListenAddress = ":8080"
+	}
+	return db.Config, nil
+}
+
 func (app *Kosync) PersistDatabase() error {
+	start := time.Now()
+	defer func() {
+		databasePersistDuration.Observe(time.Since(start).Seconds())
+	}()
+
 	// marshal to json
 	data, err := json.MarshalIndent(app.Db, "", "  ")
 	if err != nil {
-		app.PrintDebug("DB", "-", fmt.Sprintf("Failed to marshel the Database into JSON: %e", err))
+		app.Logger("DB").Debug("Failed to marshal the Database into JSON", "error", err)
+		app.LastPersistError.Store(err.Error())
 		return err
 	}
 	// write to disk
 	err = os.WriteFile(app.DbFile, data, 0600)
 	if err != nil {
-		app.PrintDebug("DB", "-", fmt.Sprintf("Failed to save the Database to disk: %e", err))
+		app.Logger("DB").Debug("Failed to save the Database to disk", "error", err)
+		app.LastPersistError.Store(err.Error())
 		return err
 	}
-	app.PrintDebug("DB", "-", fmt.Sprintf("Wrote %d bytes to disk", len(data)))
+	app.Logger("DB").Debug("Wrote database to disk", "bytes", len(data))
+	app.LastPersistError.Store("")
 	return nil
 }
 
-func (app *Kosync) AddUser(username, password string) error {
-	app.DbLock.Lock()
+// PasswordKey returns the key KOReader sends for a password
+func PasswordKey(password string) string {
+	// NOTE: Must be MD5 because that is what the KOReader Plugin is hardcoded to use
+	// bearer:disable go_gosec_crypto_weak_crypto
+	// bearer:disable go_lang_weak_hash_md5
+	return fmt.Sprintf("%x", md5.Sum([]byte(password)))
+}
+
+// AddUser creates a user in the tenant, users outside of tenants have an empty tenant
+func (app *Kosync) AddUser(tenant, username, password string) error {
+	app.LockDb()
 	defer app.DbLock.Unlock()
 
-	_, found := app.Db.Users[username]
+	userId := UserKey(tenant, username)
+	_, found := app.Db.Users[userId]
 	if found {
 		return fmt.Errorf("username is already taken")
 	}
+	// The quota is checked under the same lock as the insert, so parallel signups can not exceed it
+	if tenantData, found := app.Db.FindTenant(tenant); found && tenantData.Quotas.MaxUsers > 0 && app.Db.TenantUserCount(tenant) >= tenantData.Quotas.MaxUsers {
+		return fiber.ErrPaymentRequired
+	}
 
 	// Create user
-	app.Db.Users[username] = UserData{
+	app.Db.Users[userId] = UserData{
 		Username:  username,
 		Password:  password,
 		Documents: make(map[string]FileData),
 		History:   make(map[string]HistoryData),
+		Aliases:   make(map[string]string),
+		Webhooks:  make([]WebhookData, 0),
+		Tenant:    tenant,
 	}
 
 	// Persist new user
-	return app.PersistDatabase()
+	if err := app.PersistDatabase(); err != nil {
+		return err
+	}
+	app.FireWebhooks(userId, WebhookEventUserCreated, map[string]string{"username": userId})
+	return nil
 }
 
 func (app *Kosync) AddOrUpdateDocument(username string, document DocumentData) error {
-	app.DbLock.Lock()
+	app.LockDb()
 	defer app.DbLock.Unlock()
 
+	// Progress of merged documents is stored on the canonical document
+	document.Document = app.Db.Users[username].ResolveDocumentId(document.Document)
+	if err := app.Db.CheckDocumentLimit(app.Db.Users[username], document.Document); err != nil {
+		return err
+	}
+
 	var currentVersion, hasCurrent = app.Db.Users[username].Documents[document.Document]
 	if app.Db.Config.StoreHistory {
 		var previousData = app.Db.Users[username].History[document.Document].DocumentHistory
 		app.Db.Users[username].History[document.Document] = HistoryData{
-			DocumentHistory: append(previousData, currentVersion),
+			DocumentHistory: app.Db.Config.Limits.TrimHistory(append(previousData, currentVersion)),
 		}
-		app.PrintDebug("DB", "-", fmt.Sprintf("[user: %s]: Document '%s' progress went from %.2f %% to %.2f %%", username, document.Document, currentVersion.Percentage*100, document.Percentage*100))
+		app.Logger("DB").Debug("Document progress changed", "user", username, "document", document.Document, "from", currentVersion.Percentage, "to", document.Percentage)
 	}
 
-	// Special handling to keep pretty name persistent
+	// Special handling to keep pretty name and metadata persistent
 	var prettyName = ""
+	var metadata = DocumentMetadata{Authors: make([]string, 0), Tags: make([]string, 0), Status: DocumentStatusReading}
 	if hasCurrent {
 		prettyName = currentVersion.PrettyName
+		metadata = currentVersion.Metadata
+	}
+	if metadata.Status == DocumentStatusReading && document.Percentage >= FinishedPercentage {
+		metadata.Status = DocumentStatusFinished
 	}
 
 	// Create document state
@@ -152,23 +261,257 @@ func (app *Kosync) AddOrUpdateDocument(username string, document DocumentData) e
 		ProgressData: document.ProgressData,
 		Timestamp:    time.Now().Unix(),
 		PrettyName:   prettyName,
+		Metadata:     metadata,
 	}
+	app.InvalidateStats(username)
 
-	// Persist new user
-	return app.PersistDatabase()
+	// Persist new document state
+	newVersion := app.Db.Users[username].Documents[document.Document]
+	if err := app.persistAndPublish(username, EventDocumentProgress, newVersion); err != nil {
+		return err
+	}
+	app.FireWebhooks(username, WebhookEventProgress, newVersion)
+	if currentVersion.Percentage < FinishedPercentage && newVersion.Percentage >= FinishedPercentage {
+		app.FireWebhooks(username, WebhookEventFinished, newVersion)
+	}
+	return nil
 }
 
 func (app *Kosync) UpdateDocumentPrettyName(userId, documentId, prettyName string) error {
-	app.DbLock.Lock()
+	app.LockDb()
 	defer app.DbLock.Unlock()
 
+	documentId = app.Db.Users[userId].ResolveDocumentId(documentId)
+	if err := app.Db.CheckDocumentLimit(app.Db.Users[userId], documentId); err != nil {
+		return err
+	}
 	origDoc := app.Db.Users[userId].Documents[documentId]
 	app.Db.Users[userId].Documents[documentId] = FileData{
 		ProgressData: origDoc.ProgressData,
 		DocumentId:   origDoc.DocumentId,
 		Timestamp:    origDoc.Timestamp,
 		PrettyName:   prettyName,
+		Metadata:     origDoc.Metadata,
+	}
+
+	return app.persistAndPublish(userId, EventDocumentUpdated, app.Db.Users[userId].Documents[documentId])
+}
+
+// HasDocument reports whether the user has the document or a document it is merged into
+func (app *Kosync) HasDocument(userId, documentId string) bool {
+	app.LockDb()
+	defer app.DbLock.Unlock()
+
+	user := app.Db.Users[userId]
+	_, found := user.Documents[user.ResolveDocumentId(documentId)]
+	return found
+}
+
+func (app *Kosync) UpdateDocumentMetadata(userId, documentId string, metadata DocumentMetadata) error {
+	app.LockDb()
+	defer app.DbLock.Unlock()
+
+	documentId = app.Db.Users[userId].ResolveDocumentId(documentId)
+	origDoc, found := app.Db.Users[userId].Documents[documentId]
+	if !found {
+		return fmt.Errorf("document '%s' does not exist", documentId)
+	}
+	origDoc.Metadata = metadata
+	app.Db.Users[userId].Documents[documentId] = origDoc
+
+	return app.persistAndPublish(userId, EventDocumentUpdated, origDoc)
+}
+
+// MergeDocuments makes the aliases point to the canonical document.
+// Progress and history of the aliases are moved to the canonical document, the latest progress wins.
+func (app *Kosync) MergeDocuments(userId, canonicalId string, aliases []string) error {
+	app.LockDb()
+	defer app.DbLock.Unlock()
+
+	user, found := app.Db.Users[userId]
+	if !found {
+		return fmt.Errorf("user '%s' does not exist", userId)
+	}
+	canonicalId = user.ResolveDocumentId(canonicalId)
+	canonical, found := user.Documents[canonicalId]
+	if !found {
+		return fmt.Errorf("document '%s' does not exist", canonicalId)
+	}
+	if user.Aliases == nil {
+		user.Aliases = make(map[string]string)
+	}
+
+	timeline := user.History[canonicalId].DocumentHistory
+	for _, alias := range aliases {
+		if alias == canonicalId || len(alias) == 0 {
+			continue
+		}
+
+		if aliasDoc, found := user.Documents[alias]; found {
+			timeline = append(timeline, user.History[alias].DocumentHistory...)
+			if aliasDoc.Timestamp > canonical.Timestamp {
+				timeline = append(timeline, canonical)
+				canonical.ProgressData = aliasDoc.ProgressData
+				canonical.Timestamp = aliasDoc.Timestamp
+			} else {
+				timeline = append(timeline, aliasDoc)
+			}
+			if len(canonical.PrettyName) == 0 {
+				canonical.PrettyName = aliasDoc.PrettyName
+			}
+			delete(user.Documents, alias)
+			delete(user.History, alias)
+		}
+
+		// Aliases of the alias now point to the canonical document
+		for otherAlias, target := range user.Aliases {
+			if target == alias {
+				user.Aliases[otherAlias] = canonicalId
+			}
+		}
+		user.Aliases[alias] = canonicalId
+		app.Logger("DB").Debug("Merged document", "user", userId, "alias", alias, "document", canonicalId)
+	}
+
+	user.Documents[canonicalId] = canonical
+	if app.Db.Config.StoreHistory {
+		sort.SliceStable(timeline, func(i, j int) bool {
+			return timeline[i].Timestamp < timeline[j].Timestamp
+		})
+		user.History[canonicalId] = HistoryData{DocumentHistory: timeline}
+	}
+	app.Db.Users[userId] = user
+	app.InvalidateStats(userId)
+
+	return app.persistAndPublish(userId, EventDocumentMerged, canonical)
+}
+
+// UnmergeDocument removes an alias, the next progress push for it creates a separate document again
+func (app *Kosync) UnmergeDocument(userId, alias string) error {
+	app.LockDb()
+	defer app.DbLock.Unlock()
+
+	if _, found := app.Db.Users[userId].Aliases[alias]; !found {
+		return fmt.Errorf("document '%s' is not merged", alias)
+	}
+	delete(app.Db.Users[userId].Aliases, alias)
+
+	return app.persistAndPublish(userId, EventDocumentUnmerged, FileData{DocumentId: alias})
+}
+
+// persistAndPublish persists the database and notifies the subscribers of the user when that succeeded
+func (app *Kosync) persistAndPublish(username, eventType string, document FileData) error {
+	if err := app.PersistDatabase(); err != nil {
+		return err
+	}
+	app.Events.Publish(username, Event{
+		Type:      eventType,
+		Timestamp: time.Now().Unix(),
+		Document:  document,
+	})
+	return nil
+}
+
+// DeleteUser removes the user with all documents, history, webhooks and webhook deliveries and ends the event streams of the user.
+// The username is replaced in the audit log by the returned pseudonym.
+func (app *Kosync) DeleteUser(userId string) (string, error) {
+	app.LockDb()
+	defer app.DbLock.Unlock()
+
+	user, found := app.Db.Users[userId]
+	if !found {
+		return "", fmt.Errorf("user '%s' does not exist", userId)
+	}
+	delete(app.Db.Users, userId)
+	if err := app.PersistDatabase(); err != nil {
+		app.Db.Users[userId] = user
+		return "", err
+	}
+
+	app.InvalidateStats(userId)
+	app.Events.Close(userId)
+
+	// A new user with the same name must not see the entries of the deleted one
+	pseudonym := newAuditPseudonym()
+	if err := app.ReplaceAuditUsername(userId, pseudonym); err != nil {
+		app.Logger("Users").Error("Failed to pseudonymize the audit log of the deleted user", "error", err)
+	}
+	if err := app.ReplaceWebhookDeliveryUsername(userId, ""); err != nil {
+		app.Logger("Users").Error("Failed to remove the webhook deliveries of the deleted user", "error", err)
+	}
+	return pseudonym, nil
+}
+
+// ChangeUserPassword replaces the key of the user and ends the event streams that were opened with the old key
+func (app *Kosync) ChangeUserPassword(userId, key string) error {
+	app.LockDb()
+	defer app.DbLock.Unlock()
+
+	user, found := app.Db.Users[userId]
+	if !found {
+		return fmt.Errorf("user '%s' does not exist", userId)
+	}
+	previous := user.Password
+	user.Password = key
+	app.Db.Users[userId] = user
+	if err := app.PersistDatabase(); err != nil {
+		user.Password = previous
+		app.Db.Users[userId] = user
+		return err
+	}
+
+	app.Events.Close(userId)
+	return nil
+}
+
+// RenameUser moves the user with all data to a new username within its tenant and ends the event streams of the old username
+func (app *Kosync) RenameUser(userId, newUsername string) error {
+	app.LockDb()
+	defer app.DbLock.Unlock()
+
+	user, found := app.Db.Users[userId]
+	if !found {
+		return fmt.Errorf("user '%s' does not exist", userId)
+	}
+	newUserId := UserKey(user.Tenant, newUsername)
+	if _, taken := app.Db.Users[newUserId]; taken {
+		return fmt.Errorf("username is already taken")
+	}
+
+	delete(app.Db.Users, userId)
+	previousUsername := user.Username
+	user.Username = newUsername
+	app.Db.Users[newUserId] = user
+	if err := app.PersistDatabase(); err != nil {
+		delete(app.Db.Users, newUserId)
+		user.Username = previousUsername
+		app.Db.Users[userId] = user
+		return err
+	}
+
+	app.InvalidateStats(userId)
+	app.Events.Close(userId)
+
+	// The logs are keyed by username, a new user with the old name must not see these entries
+	if err := app.ReplaceAuditUsername(userId, newUserId); err != nil {
+		app.Logger("Users").Error("Failed to move the audit log entries to the new username", "error", err)
+	}
+	if err := app.ReplaceWebhookDeliveryUsername(userId, newUserId); err != nil {
+		app.Logger("Users").Error("Failed to move the webhook deliveries to the new username", "error", err)
+	}
+	return nil
+}
+
+func (app *Kosync) UpdateUserWebhooks(userId string, webhooks []WebhookData) error {
+	app.LockDb()
+	defer app.DbLock.Unlock()
+
+	user, found := app.Db.Users[userId]
+	if !found {
+		return fmt.Errorf("user '%s' does not exist", userId)
 	}
+	user.Webhooks = webhooks
+	app.Db.Users[userId] = user
 
 	return app.PersistDatabase()
 }
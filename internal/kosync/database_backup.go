@@ -7,17 +7,14 @@
 package kosync
 
 import (
-	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"io/fs"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
-
-	"github.com/shamaton/msgpack/v3"
 )
 
 const (
@@ -26,113 +23,124 @@ const (
 	BackupEncodingTypeMsgpack = "msgpack"
 )
 
-func (app *Kosync) BackupDatabase() error {
+// BackupDatabase writes a backup file into the backup directory and returns its path
+func (app *Kosync) BackupDatabase() (backupFileName string, err error) {
+	defer func() {
+		if err != nil {
+			backupsTotal.Inc("failure")
+		} else {
+			backupsTotal.Inc("success")
+		}
+	}()
+
 	if err := app.PersistDatabase(); err != nil {
-		return err
+		return "", err
 	}
 
-	app.DbLock.Lock()
-	defer app.DbLock.Unlock()
+	backupFileName, err = app.writeBackupFile()
+	if err != nil {
+		return "", err
+	}
 
-	var contentType = ""
-	var binaryData []byte
-	var err error
+	// Uploads happen without holding the DbLock, a failing upload keeps the local backup
+	app.LockDb()
+	remote, retention := app.Db.Config.BackupRemote, app.Db.Config.BackupRetention
+	app.DbLock.Unlock()
+	if len(remote.Type) > 0 {
+		if err := app.UploadBackup(remote, retention, backupFileName); err != nil {
+			backupUploadsTotal.Inc("failure")
+			app.Logger("Backup").Error("Failed to upload backup", "remote", remote.Type, "error", err)
+		} else {
+			backupUploadsTotal.Inc("success")
+		}
+	}
+	return backupFileName, nil
+}
+
+// writeBackupFile encodes the database into a new file in the backup directory and applies the local retention rules
+func (app *Kosync) writeBackupFile() (backupFileName string, err error) {
+	app.LockDb()
+	defer app.DbLock.Unlock()
 
-	if app.Db.Config.BackupEncodingType == BackupEncodingTypeJson || app.Db.Schema < 2 {
-		binaryData, err = json.Marshal(app.Db)
-		contentType = "application/json"
-	} else if app.Db.Config.BackupEncodingType == BackupEncodingTypeMsgpack {
-		binaryData, err = msgpack.Marshal(app.Db)
-		contentType = "application/vnd.msgpack"
-	} else {
-		return fmt.Errorf("can not create database backup for unknown content type '%s'", app.Db.Config.BackupEncodingType)
+	passphrase, err := BackupPassphrase(app.Db.Config)
+	if err != nil {
+		return "", err
 	}
+	now := time.Now()
+	block, err := EncodeBackup(app.Db, passphrase, now)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	now := time.Now()
-	block := pem.Block{
-		Type: BackupFileType,
-		Headers: map[string]string{
-			"App":          "https://git.obth.eu/atjontv/kosync",
-			"Content-Type": contentType,
-			"Created-At":   now.Format(time.RFC3339),
-			"Schema":       fmt.Sprintf("%d", app.Db.Schema),
-		},
-		Bytes: binaryData,
-	}
-
-	backupFileName := filepath.Join(filepath.Dir(app.DbFile), fmt.Sprintf("database_%s-%s.bak", now.Format(time.DateOnly), now.Format(time.TimeOnly)))
-	backupFile, err := os.OpenFile(backupFileName, os.O_CREATE+os.O_RDWR, fs.FileMode(0600))
+	backupDir := app.BackupDirectory()
+	if err := os.MkdirAll(backupDir, 0700); err != nil {
+		return "", err
+	}
+	backupFileName = filepath.Join(backupDir, BackupFileName(now))
+	backupFile, err := os.OpenFile(backupFileName, os.O_CREATE+os.O_RDWR+os.O_TRUNC, fs.FileMode(0600))
 	defer func(backupFile *os.File) {
 		err := backupFile.Close()
 		if err != nil {
-			app.PrintDebug("Backup", "-", fmt.Sprintf("Failed to close backup file '%s': %v", backupFileName, err))
+			app.Logger("Backup").Debug("Failed to close backup file", "file", backupFileName, "error", err)
 		}
 	}(backupFile)
 	if err != nil {
-		return err
+		return "", err
 	}
 	// Encode and write to file
-	err = pem.Encode(backupFile, &block)
+	err = pem.Encode(backupFile, block)
 	if err != nil {
-		return err
+		return "", err
 	}
-	app.PrintDebug("Backup", "-", fmt.Sprintf("Created backup file '%s'", backupFileName))
-	return nil
+	app.Logger("Backup").Debug("Created backup file", "file", backupFileName)
+	app.Audit(nil, AuditBackupCreated, "", map[string]string{"file": filepath.Base(backupFileName)})
+	app.FireWebhooks("", WebhookEventBackupCreated, map[string]string{
+		"file":       filepath.Base(backupFileName),
+		"created_at": now.Format(time.RFC3339),
+	})
+
+	// A failing cleanup must not fail the backup itself
+	if err := app.ApplyBackupRetention(); err != nil {
+		app.Logger("Backup").Error("Failed to apply backup retention", "error", err)
+	}
+	return backupFileName, nil
 }
 
 func RestoreDatabase(backupFile string) error {
 	// bearer:disable go_lang_log_output_neutralization
 	// bearer:disable go_lang_logger_leak
-	log.Printf("[Restore]: Trying to restore database from file '%s'\n", backupFile)
+	slog.Info("Trying to restore database", "module", "Restore", "file", backupFile)
 
 	_, dbFile, err := FindDatabaseFile()
 	if err != nil {
 		return err
 	}
 
-	// bearer:disable go_gosec_filesystem_filereadtaint
-	backupData, err := os.ReadFile(backupFile)
+	// The passphrase and the backup remote are read from the config of the current database, which is replaced by the restore
+	config, err := ReadConfig()
 	if err != nil {
 		return err
 	}
 
-	pemData, _ := pem.Decode(backupData)
-
-	if pemData.Type != BackupFileType {
-		return fmt.Errorf("the backup file does not contain a KOsync backup. It contains: '%s'", pemData.Type)
-	}
-
-	contentType, found := pemData.Headers["Content-Type"]
-	if !found {
-		return fmt.Errorf("the backup file does not specify a content type and cant be decoded")
+	backupData, err := ReadBackup(backupFile, config)
+	if err != nil {
+		return err
 	}
-
-	_, found = pemData.Headers["Schema"]
-	if !found {
-		return fmt.Errorf("the backup file does not specify a schema version and cant be restored")
+	passphrase, err := BackupPassphrase(config)
+	if err != nil {
+		return err
 	}
 
-	var db Database
-	if contentType == "application/json" {
-		if err := json.Unmarshal(pemData.Bytes, &db); err != nil {
-			return err
-		}
-	} else if contentType == "application/vnd.msgpack" {
-		if err := msgpack.Unmarshal(pemData.Bytes, &db); err != nil {
-			return err
-		}
-	} else {
-		return fmt.Errorf("content type of backup file is not supported '%s'", contentType)
+	db, _, err := DecodeBackup(backupData, passphrase)
+	if err != nil {
+		return err
 	}
 
 	if db.Schema > SchemaVersion {
 		return fmt.Errorf("can not restore a backup from a newer version. The backup has schema version %d while the server has %d", db.Schema, SchemaVersion)
 	}
 
-	log.Println("[Restore]: Restoring the database file")
+	slog.Info("Restoring the database file", "module", "Restore")
 	tmpKosync := Kosync{
 		Db:     db,
 		DbLock: sync.Mutex{},
@@ -143,6 +151,72 @@ func RestoreDatabase(backupFile string) error {
 		return err
 	}
 
-	log.Println("[Restore]: Restore complete.")
+	slog.Info("Restore complete", "module", "Restore")
 	return nil
 }
+
+// RestoreBackupData restores the contents of a backup file into the database of the running server and returns the changes.
+// The backup is migrated to the current schema and a backup of the current database is created before it is replaced.
+func (app *Kosync) RestoreBackupData(backupData []byte, options RestoreOptions) ([]RestoreChangeData, error) {
+	app.LockDb()
+	config := app.Db.Config
+	app.DbLock.Unlock()
+
+	passphrase, err := BackupPassphrase(config)
+	if err != nil {
+		return nil, err
+	}
+	db, _, err := DecodeBackup(backupData, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if db.Schema > SchemaVersion {
+		return nil, fmt.Errorf("can not restore a backup from a newer version. The backup has schema version %d while the server has %d", db.Schema, SchemaVersion)
+	}
+
+	// Migrate the backup in memory, nothing is written until the database is swapped
+	if err := MigrateDatabase(&db, SchemaVersion, nil); err != nil {
+		return nil, err
+	}
+
+	if !options.DryRun {
+		if _, err := app.BackupDatabase(); err != nil {
+			return nil, fmt.Errorf("failed to backup the current database: %w", err)
+		}
+	}
+
+	// Requests wait for the DbLock while the database is swapped
+	app.LockDb()
+	defer app.DbLock.Unlock()
+	restored := db
+	if options.Partial() {
+		if restored, err = SelectiveRestore(app.Db, db, options); err != nil {
+			return nil, err
+		}
+	}
+	// The config of the backup replaces the running config, so it must be usable before the swap
+	if err := ValidateTenants(restored.Config.Tenants); err != nil {
+		return nil, err
+	}
+	logging, err := NewLogging(restored.Config)
+	if err != nil {
+		return nil, err
+	}
+	changes := DiffDatabases(app.Db, restored)
+	if options.DryRun {
+		return changes, nil
+	}
+
+	previous := app.Db
+	app.Db = restored
+	if err := app.PersistDatabase(); err != nil {
+		app.Db = previous
+		return nil, err
+	}
+	app.UseLogging(logging)
+
+	app.ClearStats()
+
+	app.Logger("Restore").Info("Restored database from backup", "schema", db.Schema, "partial", options.Partial(), "changes", len(changes))
+	return changes, nil
+}
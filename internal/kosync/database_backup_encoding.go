@@ -0,0 +1,340 @@
+//
+// File:        internal/kosync/database_backup_encoding.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/shamaton/msgpack/v3"
+)
+
+const (
+	BackupCompressionGzip = "gzip"
+	BackupCompressionZstd = "zstd"
+	BackupEncryptionAes   = "AES-256-GCM"
+	BackupKdfPbkdf2       = "PBKDF2-SHA256"
+	BackupKdfIterations   = 600_000
+	// BackupKdfMaxIterations bounds the work a crafted backup file can cause before the passphrase is checked
+	BackupKdfMaxIterations = 10 * BackupKdfIterations
+	// BackupMaxPayloadSize bounds the decompressed payload, a small compressed backup can not exhaust the memory
+	BackupMaxPayloadSize = 1 << 30
+
+	// BackupPassphraseEnv takes precedence over the backup_key_file config
+	BackupPassphraseEnv = "KOSYNC_BACKUP_PASSPHRASE"
+)
+
+// BackupPassphrase returns the passphrase for backup encryption from the environment or the configured key file
+func BackupPassphrase(config ConfigData) (string, error) {
+	if passphrase, found := os.LookupEnv(BackupPassphraseEnv); found && len(passphrase) > 0 {
+		return passphrase, nil
+	}
+	if len(config.BackupKeyFile) == 0 {
+		return "", nil
+	}
+	data, err := os.ReadFile(config.BackupKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup key file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// EncodeBackup serializes, compresses and encrypts the database into a PEM block according to the config
+func EncodeBackup(db Database, passphrase string, createdAt time.Time) (*pem.Block, error) {
+	var contentType = ""
+	var binaryData []byte
+	var err error
+
+	if db.Config.BackupEncodingType == BackupEncodingTypeJson || db.Schema < 2 {
+		binaryData, err = json.Marshal(db)
+		contentType = "application/json"
+	} else if db.Config.BackupEncodingType == BackupEncodingTypeMsgpack {
+		binaryData, err = msgpack.Marshal(db)
+		contentType = "application/vnd.msgpack"
+	} else {
+		return nil, fmt.Errorf("can not create database backup for unknown content type '%s'", db.Config.BackupEncodingType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block := &pem.Block{
+		Type: BackupFileType,
+		Headers: map[string]string{
+			"App":          "https://git.obth.eu/atjontv/kosync",
+			"Content-Type": contentType,
+			"Created-At":   createdAt.Format(time.RFC3339),
+			"Schema":       fmt.Sprintf("%d", db.Schema),
+		},
+	}
+
+	if len(db.Config.BackupCompression) > 0 {
+		if binaryData, err = compressBackup(db.Config.BackupCompression, binaryData); err != nil {
+			return nil, err
+		}
+		block.Headers["Content-Encoding"] = db.Config.BackupCompression
+	}
+
+	if len(db.Config.BackupEncryption) > 0 {
+		if db.Config.BackupEncryption != BackupEncryptionAes {
+			return nil, fmt.Errorf("can not create database backup for unknown encryption '%s'", db.Config.BackupEncryption)
+		}
+		if len(passphrase) == 0 {
+			return nil, fmt.Errorf("backup encryption is enabled but no passphrase is configured")
+		}
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		aead, err := newBackupCipher(passphrase, salt, BackupKdfIterations)
+		if err != nil {
+			return nil, err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		block.Headers["Encryption"] = BackupEncryptionAes
+		block.Headers["Encryption-Kdf"] = BackupKdfPbkdf2
+		block.Headers["Encryption-Kdf-Iterations"] = strconv.Itoa(BackupKdfIterations)
+		block.Headers["Encryption-Salt"] = base64.StdEncoding.EncodeToString(salt)
+		block.Headers["Encryption-Nonce"] = base64.StdEncoding.EncodeToString(nonce)
+		binaryData = aead.Seal(nil, nonce, binaryData, backupAdditionalData(block.Headers))
+	}
+
+	block.Bytes = binaryData
+	block.Headers["Checksum"] = backupChecksum(binaryData)
+	return block, nil
+}
+
+// DecodeBackup reverses EncodeBackup, the passphrase is only needed for encrypted backups
+func DecodeBackup(backupData []byte, passphrase string) (Database, *pem.Block, error) {
+	pemData, err := DecodeBackupBlock(backupData)
+	if err != nil {
+		return Database{}, nil, err
+	}
+
+	db, err := DecodeBackupPayload(pemData, passphrase)
+	if err != nil {
+		return Database{}, nil, err
+	}
+	return db, pemData, nil
+}
+
+// DecodeBackupBlock decodes the PEM block of a backup file and verifies its checksum without decoding the payload
+func DecodeBackupBlock(backupData []byte) (*pem.Block, error) {
+	pemData, _ := pem.Decode(backupData)
+	if pemData == nil {
+		return nil, fmt.Errorf("the backup file is not PEM encoded")
+	}
+
+	if pemData.Type != BackupFileType {
+		return nil, fmt.Errorf("the backup file does not contain a KOsync backup. It contains: '%s'", pemData.Type)
+	}
+
+	// Backups of older versions have no checksum, they were neither compressed nor encrypted
+	checksum, found := pemData.Headers["Checksum"]
+	if !found {
+		_, compressed := pemData.Headers["Content-Encoding"]
+		_, encrypted := pemData.Headers["Encryption"]
+		if compressed || encrypted {
+			return nil, fmt.Errorf("the backup file is damaged, it has no checksum")
+		}
+	} else if actual := backupChecksum(pemData.Bytes); actual != checksum {
+		return nil, fmt.Errorf("the backup file is damaged, its checksum is '%s' but '%s' is expected", actual, checksum)
+	}
+
+	return pemData, nil
+}
+
+// DecodeBackupPayload decrypts, decompresses and deserializes the database of a decoded backup block
+func DecodeBackupPayload(pemData *pem.Block, passphrase string) (Database, error) {
+	contentType, found := pemData.Headers["Content-Type"]
+	if !found {
+		return Database{}, fmt.Errorf("the backup file does not specify a content type and cant be decoded")
+	}
+
+	_, found = pemData.Headers["Schema"]
+	if !found {
+		return Database{}, fmt.Errorf("the backup file does not specify a schema version and cant be restored")
+	}
+
+	payload := pemData.Bytes
+	if encryption, found := pemData.Headers["Encryption"]; found {
+		var err error
+		if payload, err = decryptBackup(encryption, pemData.Headers, payload, passphrase); err != nil {
+			return Database{}, err
+		}
+	}
+	if encoding, found := pemData.Headers["Content-Encoding"]; found {
+		var err error
+		if payload, err = decompressBackup(encoding, payload, BackupMaxPayloadSize); err != nil {
+			return Database{}, err
+		}
+	}
+
+	var db Database
+	if contentType == "application/json" {
+		if err := json.Unmarshal(payload, &db); err != nil {
+			return Database{}, err
+		}
+	} else if contentType == "application/vnd.msgpack" {
+		if err := msgpack.Unmarshal(payload, &db); err != nil {
+			return Database{}, err
+		}
+	} else {
+		return Database{}, fmt.Errorf("content type of backup file is not supported '%s'", contentType)
+	}
+
+	return db, nil
+}
+
+// backupAdditionalData returns the headers that describe how the payload is decoded in a canonical form.
+// They are authenticated together with the encrypted payload, so they can not be changed without the passphrase.
+func backupAdditionalData(headers map[string]string) []byte {
+	var data strings.Builder
+	for _, name := range []string{"Content-Type", "Content-Encoding", "Schema", "Encryption", "Encryption-Kdf", "Encryption-Kdf-Iterations"} {
+		value, found := headers[name]
+		if !found {
+			continue
+		}
+		data.WriteString(name)
+		data.WriteString(": ")
+		data.WriteString(value)
+		data.WriteString("\n")
+	}
+	return []byte(data.String())
+}
+
+// backupChecksum returns the SHA-256 of the stored payload in the format of the Checksum header
+func backupChecksum(payload []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(payload))
+}
+
+func compressBackup(encoding string, data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+	switch encoding {
+	case BackupCompressionGzip:
+		writer = gzip.NewWriter(&buffer)
+	case BackupCompressionZstd:
+		zstdWriter, err := zstd.NewWriter(&buffer)
+		if err != nil {
+			return nil, err
+		}
+		writer = zstdWriter
+	default:
+		return nil, fmt.Errorf("can not create database backup for unknown compression '%s'", encoding)
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// decompressBackup decompresses the payload and fails when it is larger than maxSize
+func decompressBackup(encoding string, data []byte, maxSize int64) ([]byte, error) {
+	var reader io.Reader
+	switch encoding {
+	case BackupCompressionGzip:
+		gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = gzipReader.Close()
+		}()
+		reader = gzipReader
+	case BackupCompressionZstd:
+		zstdReader, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	default:
+		return nil, fmt.Errorf("content encoding of backup file is not supported '%s'", encoding)
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(payload)) > maxSize {
+		return nil, fmt.Errorf("the backup file decompresses to more than %d bytes", maxSize)
+	}
+	return payload, nil
+}
+
+func decryptBackup(encryption string, headers map[string]string, data []byte, passphrase string) ([]byte, error) {
+	if encryption != BackupEncryptionAes {
+		return nil, fmt.Errorf("encryption of backup file is not supported '%s'", encryption)
+	}
+	if kdf := headers["Encryption-Kdf"]; kdf != BackupKdfPbkdf2 {
+		return nil, fmt.Errorf("key derivation of backup file is not supported '%s'", kdf)
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("the backup file is encrypted, set the passphrase via %s or backup_key_file", BackupPassphraseEnv)
+	}
+
+	iterations, err := strconv.Atoi(headers["Encryption-Kdf-Iterations"])
+	if err != nil || iterations < 1 || iterations > BackupKdfMaxIterations {
+		return nil, fmt.Errorf("the backup file has invalid key derivation iterations")
+	}
+	salt, err := base64.StdEncoding.DecodeString(headers["Encryption-Salt"])
+	if err != nil {
+		return nil, fmt.Errorf("the backup file has an invalid encryption salt")
+	}
+	nonce, err := base64.StdEncoding.DecodeString(headers["Encryption-Nonce"])
+	if err != nil {
+		return nil, fmt.Errorf("the backup file has an invalid encryption nonce")
+	}
+
+	aead, err := newBackupCipher(passphrase, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("the backup file has an invalid encryption nonce")
+	}
+	plaintext, err := aead.Open(nil, nonce, data, backupAdditionalData(headers))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the backup file, the passphrase is wrong or the file is damaged")
+	}
+	return plaintext, nil
+}
+
+func newBackupCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,136 @@
+//
+// File:        internal/kosync/database_backup_encoding_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/pem"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBackupPassphrase = "correct horse battery staple"
+
+// newTestBackupDatabase returns a database with one document stored with the encoding, compression and encryption
+func newTestBackupDatabase(t *testing.T, encoding, compression, encryption string) Database {
+	t.Helper()
+	app := newTestApp(t)
+	addTestUser(app, "", "alice")
+	app.Db.Users["alice"].Documents["0123456789abcdef0123456789abcdef"] = FileData{
+		ProgressData: ProgressData{Percentage: 0.5, Progress: "/body/p[1]", Device: "Kobo"},
+		DocumentId:   "0123456789abcdef0123456789abcdef",
+		Timestamp:    1700000000,
+	}
+	app.Db.Config.BackupEncodingType = encoding
+	app.Db.Config.BackupCompression = compression
+	app.Db.Config.BackupEncryption = encryption
+	return app.Db
+}
+
+func encodeTestBackup(t *testing.T, db Database) *pem.Block {
+	t.Helper()
+	block, err := EncodeBackup(db, testBackupPassphrase, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	for _, encoding := range []string{BackupEncodingTypeJson, BackupEncodingTypeMsgpack} {
+		for _, compression := range []string{"", BackupCompressionGzip, BackupCompressionZstd} {
+			for _, encryption := range []string{"", BackupEncryptionAes} {
+				t.Run(strings.Join([]string{encoding, compression, encryption}, "_"), func(t *testing.T) {
+					db := newTestBackupDatabase(t, encoding, compression, encryption)
+					restored, _, err := DecodeBackup(pem.EncodeToMemory(encodeTestBackup(t, db)), testBackupPassphrase)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if document := restored.Users["alice"].Documents["0123456789abcdef0123456789abcdef"]; document.Progress != "/body/p[1]" {
+						t.Errorf("restored document is %+v", document)
+					}
+					if restored.Config.BackupCompression != compression || restored.Schema != db.Schema {
+						t.Errorf("restored config is %+v with schema %d", restored.Config, restored.Schema)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestBackupRejectsTampering(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression string
+		encryption  string
+		tamper      func(block *pem.Block)
+	}{
+		{"payload", "", "", func(block *pem.Block) {
+			block.Bytes[0] ^= 1
+		}},
+		{"checksum of a compressed backup removed", BackupCompressionGzip, "", func(block *pem.Block) {
+			delete(block.Headers, "Checksum")
+		}},
+		{"checksum of an encrypted backup removed", "", BackupEncryptionAes, func(block *pem.Block) {
+			delete(block.Headers, "Checksum")
+		}},
+		{"encrypted payload with a new checksum", "", BackupEncryptionAes, func(block *pem.Block) {
+			block.Bytes[0] ^= 1
+			block.Headers["Checksum"] = backupChecksum(block.Bytes)
+		}},
+		{"compression header of an encrypted backup", BackupCompressionGzip, BackupEncryptionAes, func(block *pem.Block) {
+			block.Headers["Content-Encoding"] = BackupCompressionZstd
+		}},
+		{"content type of an encrypted backup", "", BackupEncryptionAes, func(block *pem.Block) {
+			block.Headers["Content-Type"] = "application/json"
+		}},
+		{"schema of an encrypted backup", "", BackupEncryptionAes, func(block *pem.Block) {
+			block.Headers["Schema"] = "1"
+		}},
+		{"iterations above the maximum", "", BackupEncryptionAes, func(block *pem.Block) {
+			block.Headers["Encryption-Kdf-Iterations"] = strconv.Itoa(BackupKdfMaxIterations + 1)
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			block := encodeTestBackup(t, newTestBackupDatabase(t, BackupEncodingTypeMsgpack, test.compression, test.encryption))
+			test.tamper(block)
+			if _, _, err := DecodeBackup(pem.EncodeToMemory(block), testBackupPassphrase); err == nil {
+				t.Error("the tampered backup was decoded")
+			}
+		})
+	}
+}
+
+func TestBackupWithoutChecksumOfOlderVersions(t *testing.T) {
+	block := encodeTestBackup(t, newTestBackupDatabase(t, BackupEncodingTypeJson, "", ""))
+	delete(block.Headers, "Checksum")
+	if _, _, err := DecodeBackup(pem.EncodeToMemory(block), ""); err != nil {
+		t.Errorf("plain backup without checksum was rejected: %v", err)
+	}
+}
+
+func TestDecompressBackupLimitsTheSize(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(make([]byte, 1<<20)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := decompressBackup(BackupCompressionGzip, compressed.Bytes(), 1<<20); err != nil {
+		t.Errorf("payload of the maximum size was rejected: %v", err)
+	}
+	if _, err := decompressBackup(BackupCompressionGzip, compressed.Bytes(), 1<<20-1); err == nil {
+		t.Error("payload above the maximum size was decompressed")
+	}
+}
@@ -0,0 +1,114 @@
+//
+// File:        internal/kosync/database_backup_remote.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	BackupRemoteS3     = "s3"
+	BackupRemoteWebdav = "webdav"
+
+	// BackupRemotePrefix marks a backup reference of --restore as the name of a backup on the remote
+	BackupRemotePrefix = "remote:"
+
+	backupRemoteTimeout = 60 * time.Second
+)
+
+// BackupRemote stores backup files outside the server, names are backup file names without the configured prefix
+type BackupRemote interface {
+	Upload(name string, data []byte) error
+	Download(name string) ([]byte, error)
+	List() ([]string, error)
+	Delete(name string) error
+}
+
+// NewBackupRemote creates the remote storage of the config, it returns nil when no remote is configured
+func NewBackupRemote(config BackupRemoteData) (BackupRemote, error) {
+	client := &http.Client{Timeout: backupRemoteTimeout}
+	switch config.Type {
+	case "":
+		return nil, nil
+	case BackupRemoteS3:
+		if len(config.Url) == 0 || len(config.Bucket) == 0 {
+			return nil, fmt.Errorf("backup remote of type '%s' requires url and bucket", config.Type)
+		}
+		return &s3Remote{config: config, client: client}, nil
+	case BackupRemoteWebdav:
+		if len(config.Url) == 0 {
+			return nil, fmt.Errorf("backup remote of type '%s' requires url", config.Type)
+		}
+		return &webdavRemote{config: config, client: client}, nil
+	default:
+		return nil, fmt.Errorf("backup remote type '%s' is not supported", config.Type)
+	}
+}
+
+// UploadBackup copies a backup file to the remote and applies the retention rules to the backups on the remote
+func (app *Kosync) UploadBackup(config BackupRemoteData, retention BackupRetentionData, backupFile string) error {
+	remote, err := NewBackupRemote(config)
+	if err != nil || remote == nil {
+		return err
+	}
+
+	// bearer:disable go_gosec_filesystem_filereadtaint
+	data, err := os.ReadFile(backupFile)
+	if err != nil {
+		return err
+	}
+	if err := remote.Upload(filepath.Base(backupFile), data); err != nil {
+		return err
+	}
+	app.Logger("Backup").Debug("Uploaded backup file", "file", filepath.Base(backupFile), "remote", config.Type)
+
+	names, err := remote.List()
+	if err != nil {
+		return err
+	}
+	for _, name := range SelectExpiredBackups(names, retention) {
+		if err := remote.Delete(name); err != nil {
+			return err
+		}
+		app.Logger("Backup").Debug("Deleted expired backup file on remote", "file", name, "remote", config.Type)
+	}
+	return nil
+}
+
+// ReadBackup reads a backup file from disk or, for references starting with BackupRemotePrefix, from the remote of the config
+func ReadBackup(reference string, config ConfigData) ([]byte, error) {
+	name, isRemote := strings.CutPrefix(reference, BackupRemotePrefix)
+	if !isRemote {
+		// bearer:disable go_gosec_filesystem_filereadtaint
+		return os.ReadFile(reference)
+	}
+
+	remote, err := NewBackupRemote(config.BackupRemote)
+	if err != nil {
+		return nil, err
+	}
+	if remote == nil {
+		return nil, fmt.Errorf("can not read '%s', no backup remote is configured", reference)
+	}
+	return remote.Download(name)
+}
+
+// checkRemoteResponse turns unsuccessful responses into errors and closes their body
+func checkRemoteResponse(resp *http.Response, action, name string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	_ = resp.Body.Close()
+	return fmt.Errorf("failed to %s '%s' on backup remote, status %d: %s", action, name, resp.StatusCode, strings.TrimSpace(string(body)))
+}
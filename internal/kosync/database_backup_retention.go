@@ -0,0 +1,138 @@
+//
+// File:        internal/kosync/database_backup_retention.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const backupFileTimeLayout = time.DateOnly + "-" + time.TimeOnly
+
+// BackupFileName returns the name of a backup file created at the given time
+func BackupFileName(createdAt time.Time) string {
+	return fmt.Sprintf("database_%s.bak", createdAt.Format(backupFileTimeLayout))
+}
+
+// ParseBackupFileName returns the creation time encoded in the name of a backup file
+func ParseBackupFileName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, "database_") || !strings.HasSuffix(name, ".bak") {
+		return time.Time{}, false
+	}
+	createdAt, err := time.ParseInLocation(backupFileTimeLayout, strings.TrimSuffix(strings.TrimPrefix(name, "database_"), ".bak"), time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return createdAt, true
+}
+
+// SelectExpiredBackups returns the backup file names that are not kept by the retention rules.
+// Names that are not backup file names are never selected. Without any rule every backup is kept.
+func SelectExpiredBackups(names []string, retention BackupRetentionData) []string {
+	if retention.KeepLast <= 0 && retention.KeepDaily <= 0 && retention.KeepWeekly <= 0 && retention.KeepMonthly <= 0 {
+		return make([]string, 0)
+	}
+
+	type backup struct {
+		name      string
+		createdAt time.Time
+	}
+	backups := make([]backup, 0, len(names))
+	for _, name := range names {
+		if createdAt, ok := ParseBackupFileName(name); ok {
+			backups = append(backups, backup{name, createdAt})
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].createdAt.After(backups[j].createdAt)
+	})
+
+	keep := make(map[string]bool)
+	for i := 0; i < len(backups) && i < retention.KeepLast; i++ {
+		keep[backups[i].name] = true
+	}
+	// Keep the newest backup of each of the latest periods
+	keepPerPeriod := func(count int, period func(time.Time) string) {
+		seen := make(map[string]bool)
+		for _, b := range backups {
+			if len(seen) >= count {
+				return
+			}
+			key := period(b.createdAt)
+			if !seen[key] {
+				seen[key] = true
+				keep[b.name] = true
+			}
+		}
+	}
+	keepPerPeriod(retention.KeepDaily, func(t time.Time) string {
+		return t.Format(time.DateOnly)
+	})
+	keepPerPeriod(retention.KeepWeekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-%d", year, week)
+	})
+	keepPerPeriod(retention.KeepMonthly, func(t time.Time) string {
+		return t.Format("2006-01")
+	})
+
+	expired := make([]string, 0)
+	for _, b := range backups {
+		if !keep[b.name] {
+			expired = append(expired, b.name)
+		}
+	}
+	return expired
+}
+
+// BackupDirectory returns the configured backup directory, relative paths are relative to the database file
+func (app *Kosync) BackupDirectory() string {
+	dir := app.Db.Config.BackupDirectory
+	if len(dir) == 0 {
+		return filepath.Dir(app.DbFile)
+	}
+	if !filepath.IsAbs(dir) {
+		return filepath.Join(filepath.Dir(app.DbFile), dir)
+	}
+	return dir
+}
+
+// ListBackups returns the names of all backup files in the backup directory
+func ListBackups(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, entry := range entries {
+		if _, ok := ParseBackupFileName(entry.Name()); ok && !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// ApplyBackupRetention deletes the backup files that are not kept by the configured retention rules
+func (app *Kosync) ApplyBackupRetention() error {
+	dir := app.BackupDirectory()
+	names, err := ListBackups(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range SelectExpiredBackups(names, app.Db.Config.BackupRetention) {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+		app.Logger("Backup").Debug("Deleted expired backup file", "file", name)
+	}
+	return nil
+}
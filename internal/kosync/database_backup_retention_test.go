@@ -0,0 +1,61 @@
+//
+// File:        internal/kosync/database_backup_retention_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSelectExpiredBackups(t *testing.T) {
+	// Backups at 03:00 and 15:00 of every day from Monday 2026-03-02 to Friday 2026-04-10
+	names := []string{"notes.txt", "database_latest.bak"}
+	for day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.Local); day.Before(time.Date(2026, 4, 11, 0, 0, 0, 0, time.Local)); day = day.AddDate(0, 0, 1) {
+		names = append(names, BackupFileName(day.Add(3*time.Hour)), BackupFileName(day.Add(15*time.Hour)))
+	}
+	tests := []struct {
+		name      string
+		retention BackupRetentionData
+		kept      []string
+	}{
+		{"last", BackupRetentionData{KeepLast: 3}, []string{
+			"database_2026-04-09-15:00:00.bak", "database_2026-04-10-03:00:00.bak", "database_2026-04-10-15:00:00.bak"}},
+		{"daily", BackupRetentionData{KeepDaily: 2}, []string{
+			"database_2026-04-09-15:00:00.bak", "database_2026-04-10-15:00:00.bak"}},
+		// ISO weeks start on Monday, the newest backup of a week is the one of Sunday
+		{"weekly", BackupRetentionData{KeepWeekly: 3}, []string{
+			"database_2026-03-29-15:00:00.bak", "database_2026-04-05-15:00:00.bak", "database_2026-04-10-15:00:00.bak"}},
+		{"monthly", BackupRetentionData{KeepMonthly: 12}, []string{
+			"database_2026-03-31-15:00:00.bak", "database_2026-04-10-15:00:00.bak"}},
+		{"combined", BackupRetentionData{KeepLast: 2, KeepDaily: 3, KeepMonthly: 2}, []string{
+			"database_2026-03-31-15:00:00.bak", "database_2026-04-08-15:00:00.bak", "database_2026-04-09-15:00:00.bak",
+			"database_2026-04-10-03:00:00.bak", "database_2026-04-10-15:00:00.bak"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expired := SelectExpiredBackups(names, test.retention)
+			kept := make([]string, 0)
+			for _, name := range names {
+				if _, isBackup := ParseBackupFileName(name); isBackup && !slices.Contains(expired, name) {
+					kept = append(kept, name)
+				}
+			}
+			if !slices.Equal(kept, test.kept) {
+				t.Errorf("kept %v, expected %v", kept, test.kept)
+			}
+			if slices.Contains(expired, "notes.txt") || slices.Contains(expired, "database_latest.bak") {
+				t.Error("files that are no backups were selected")
+			}
+		})
+	}
+
+	if expired := SelectExpiredBackups(names, BackupRetentionData{}); len(expired) != 0 {
+		t.Errorf("without rules %d backups expired", len(expired))
+	}
+}
@@ -0,0 +1,221 @@
+//
+// File:        internal/kosync/database_backup_s3.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3DefaultRegion = "us-east-1"
+	s3TimeLayout    = "20060102T150405Z"
+)
+
+// s3Remote stores backups in a bucket of an S3 compatible service, it uses path style URLs which every implementation supports
+type s3Remote struct {
+	config BackupRemoteData
+	client *http.Client
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *s3Remote) Upload(name string, data []byte) error {
+	resp, err := s.do(http.MethodPut, s.config.Prefix+name, nil, data)
+	if err != nil {
+		return err
+	}
+	if err := checkRemoteResponse(resp, "upload", name); err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *s3Remote) Download(name string) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, s.config.Prefix+name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRemoteResponse(resp, "download", name); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	return io.ReadAll(resp.Body)
+}
+
+func (s *s3Remote) List() ([]string, error) {
+	names := make([]string, 0)
+	query := url.Values{"list-type": {"2"}, "prefix": {s.config.Prefix}}
+	for {
+		resp, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkRemoteResponse(resp, "list", s.config.Bucket); err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			// Only objects directly below the prefix are backups of this server
+			name := strings.TrimPrefix(object.Key, s.config.Prefix)
+			if !strings.Contains(name, "/") {
+				names = append(names, name)
+			}
+		}
+		if !result.IsTruncated || len(result.NextContinuationToken) == 0 {
+			return names, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (s *s3Remote) Delete(name string) error {
+	resp, err := s.do(http.MethodDelete, s.config.Prefix+name, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := checkRemoteResponse(resp, "delete", name); err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// do sends a signed request for an object key of the bucket, an empty key addresses the bucket itself
+func (s *s3Remote) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	path := "/" + s3Escape(s.config.Bucket, false)
+	if len(key) > 0 {
+		path += "/" + s3Escape(key, true)
+	}
+	rawUrl := strings.TrimSuffix(s.config.Url, "/") + path
+	if len(query) > 0 {
+		rawUrl += "?" + s3CanonicalQuery(query)
+	}
+
+	req, err := http.NewRequest(method, rawUrl, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	region := s.config.Region
+	if len(region) == 0 {
+		region = s3DefaultRegion
+	}
+	signS3Request(req, body, s.config.AccessKey, s.config.SecretKey, region, time.Now())
+	return s.client.Do(req)
+}
+
+// signS3Request adds the AWS Signature Version 4 headers to a request, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func signS3Request(req *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(s3TimeLayout)
+	payloadHash := fmt.Sprintf("%x", sha256.Sum256(body))
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	headerNames := make([]string, 0, len(headers))
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", now.Format("20060102"), region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		fmt.Sprintf("%x", sha256.Sum256([]byte(canonicalRequest))),
+	}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+secretKey), now.Format("20060102"))
+	key = hmacSha256(key, region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3CanonicalQuery encodes the query sorted by key as required for signing
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, s3Escape(key, false)+"="+s3Escape(value, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes everything except the unreserved characters, slashes are kept when keepSlash is set
+func s3Escape(value string, keepSlash bool) string {
+	var escaped strings.Builder
+	for _, b := range []byte(value) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' || (keepSlash && b == '/') {
+			escaped.WriteByte(b)
+		} else {
+			escaped.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+	return escaped.String()
+}
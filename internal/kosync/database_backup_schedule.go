@@ -0,0 +1,179 @@
+//
+// File:        internal/kosync/database_backup_schedule.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BackupSchedule calculates when the next scheduled backup is due
+type BackupSchedule interface {
+	Next(after time.Time) time.Time
+}
+
+// ParseBackupSchedule accepts a Go duration like "12h", a cron expression with five fields
+// like "30 3 * * *" or one of the descriptors @hourly, @daily, @weekly and @monthly
+func ParseBackupSchedule(spec string) (BackupSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+
+	if interval, err := time.ParseDuration(spec); err == nil {
+		if interval < time.Minute {
+			return nil, fmt.Errorf("backup interval '%s' is shorter than a minute", spec)
+		}
+		return intervalSchedule(interval), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("backup schedule '%s' is neither a duration nor a cron expression with five fields", spec)
+	}
+
+	var schedule cronSchedule
+	var err error
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute field of backup schedule: %w", err)
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour field of backup schedule: %w", err)
+	}
+	if schedule.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day of month field of backup schedule: %w", err)
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month field of backup schedule: %w", err)
+	}
+	// Sunday is 0 or 7, so ranges like 1-7 work as well
+	if schedule.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("day of week field of backup schedule: %w", err)
+	}
+	if schedule.weekdays[7] {
+		schedule.weekdays[0] = true
+		delete(schedule.weekdays, 7)
+	}
+	// Like Vixie cron, a day field starting with "*" counts as unrestricted, also with a step like "*/2"
+	schedule.anyDay = strings.HasPrefix(fields[2], "*")
+	schedule.anyWeekday = strings.HasPrefix(fields[4], "*")
+	return schedule, nil
+}
+
+type intervalSchedule time.Duration
+
+func (schedule intervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(schedule))
+}
+
+type cronSchedule struct {
+	minutes    map[int]bool
+	hours      map[int]bool
+	days       map[int]bool
+	months     map[int]bool
+	weekdays   map[int]bool
+	anyDay     bool
+	anyWeekday bool
+}
+
+func (schedule cronSchedule) Next(after time.Time) time.Time {
+	next := after.Truncate(time.Minute).Add(time.Minute)
+	// Give up after five years, the expression can never match (e.g. 30th of February)
+	limit := next.AddDate(5, 0, 0)
+	for next.Before(limit) {
+		if !schedule.months[int(next.Month())] || !schedule.matchesDay(next) {
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, next.Location())
+			continue
+		}
+		if !schedule.hours[next.Hour()] {
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, next.Location())
+			continue
+		}
+		if !schedule.minutes[next.Minute()] {
+			next = next.Add(time.Minute)
+			continue
+		}
+		return next
+	}
+	return time.Time{}
+}
+
+// matchesDay follows cron semantics: when both day fields are restricted, either of them has to match
+func (schedule cronSchedule) matchesDay(t time.Time) bool {
+	dayMatches := schedule.days[t.Day()]
+	weekdayMatches := schedule.weekdays[int(t.Weekday())]
+	if schedule.anyDay || schedule.anyWeekday {
+		return dayMatches && weekdayMatches
+	}
+	return dayMatches || weekdayMatches
+}
+
+// parseCronField parses lists of values, ranges and steps like "1,15", "9-17", "*/15" or "0-30/10"
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if rangePart, stepPart, found := strings.Cut(part, "/"); found {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step '%s'", stepPart)
+			}
+			part = rangePart
+		}
+
+		start, end := min, max
+		if part != "*" {
+			startPart, endPart, isRange := strings.Cut(part, "-")
+			var err error
+			if start, err = strconv.Atoi(startPart); err != nil {
+				return nil, fmt.Errorf("invalid value '%s'", startPart)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(endPart); err != nil {
+					return nil, fmt.Errorf("invalid value '%s'", endPart)
+				}
+			} else if step > 1 {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return nil, fmt.Errorf("'%s' is out of range %d-%d", part, min, max)
+		}
+
+		for value := start; value <= end; value += step {
+			values[value] = true
+		}
+	}
+	return values, nil
+}
+
+// RunBackupSchedule creates backups according to the schedule until the process exits
+func (app *Kosync) RunBackupSchedule(schedule BackupSchedule) {
+	for {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			app.Logger("Backup").Error("Backup schedule never matches, scheduled backups are disabled")
+			return
+		}
+		app.Logger("Backup").Debug("Next scheduled backup", "at", next.Format(time.RFC3339))
+		time.Sleep(time.Until(next))
+
+		if _, err := app.BackupDatabase(); err != nil {
+			app.Logger("Backup").Error("Scheduled backup failed", "error", err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+//
+// File:        internal/kosync/database_backup_schedule_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackupScheduleNext(t *testing.T) {
+	// A Friday
+	after := time.Date(2026, 4, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"12h", time.Date(2026, 4, 11, 0, 0, 0, 0, time.UTC)},
+		{"30 3 * * *", time.Date(2026, 4, 11, 3, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 4, 10, 12, 15, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2026, 4, 10, 13, 0, 0, 0, time.UTC)},
+		{"5,10 11 * * *", time.Date(2026, 4, 11, 11, 5, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2026, 4, 12, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 4, 12, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1-5", time.Date(2026, 4, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 5-7", time.Date(2026, 4, 11, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, 4, 12, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted, either of them matches
+		{"0 0 15 * 1", time.Date(2026, 4, 13, 0, 0, 0, 0, time.UTC)},
+		// A day field with a star step counts as unrestricted, so both fields have to match: an odd day that is a Monday
+		{"0 0 */2 * 1", time.Date(2026, 4, 13, 0, 0, 0, 0, time.UTC)},
+		// The first of a month that is a Sunday, Tuesday, Thursday or Saturday
+		{"0 0 1 * */2", time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			schedule, err := ParseBackupSchedule(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next := schedule.Next(after); !next.Equal(test.next) {
+				t.Errorf("Next is %v, expected %v", next, test.next)
+			}
+		})
+	}
+}
+
+func TestParseBackupScheduleRejectsInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{"", "30s", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := ParseBackupSchedule(spec); err == nil {
+			t.Errorf("'%s' was accepted", spec)
+		}
+	}
+}
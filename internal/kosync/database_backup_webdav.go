@@ -0,0 +1,126 @@
+//
+// File:        internal/kosync/database_backup_webdav.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// webdavRemote stores backups in an existing collection of a WebDAV server
+type webdavRemote struct {
+	config BackupRemoteData
+	client *http.Client
+}
+
+type webdavMultistatus struct {
+	Responses []struct {
+		Href string `xml:"href"`
+	} `xml:"response"`
+}
+
+func (w *webdavRemote) Upload(name string, data []byte) error {
+	resp, err := w.do(http.MethodPut, w.config.Prefix+name, nil, data)
+	if err != nil {
+		return err
+	}
+	if err := checkRemoteResponse(resp, "upload", name); err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (w *webdavRemote) Download(name string) ([]byte, error) {
+	resp, err := w.do(http.MethodGet, w.config.Prefix+name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRemoteResponse(resp, "download", name); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	return io.ReadAll(resp.Body)
+}
+
+// List returns the backups in the collection of the prefix, a prefix like "kosync/database_" lists the collection "kosync/"
+func (w *webdavRemote) List() ([]string, error) {
+	directory, filePrefix := path.Split(w.config.Prefix)
+	collection, err := url.Parse(w.target(directory))
+	if err != nil {
+		return nil, err
+	}
+
+	body := []byte(`<?xml version="1.0" encoding="utf-8"?><propfind xmlns="DAV:"><prop><resourcetype/></prop></propfind>`)
+	resp, err := w.do("PROPFIND", directory, map[string]string{"Depth": "1", "Content-Type": "application/xml"}, body)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRemoteResponse(resp, "list", w.config.Url); err != nil {
+		return nil, err
+	}
+	var result webdavMultistatus
+	err = xml.NewDecoder(resp.Body).Decode(&result)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Hrefs are absolute URLs or paths, only files directly in the collection are backups
+	names := make([]string, 0)
+	for _, response := range result.Responses {
+		href, err := url.Parse(response.Href)
+		if err != nil || strings.HasSuffix(href.Path, "/") || path.Dir(href.Path) != path.Clean(collection.Path) {
+			continue
+		}
+		if name, found := strings.CutPrefix(path.Base(href.Path), filePrefix); found {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (w *webdavRemote) Delete(name string) error {
+	resp, err := w.do(http.MethodDelete, w.config.Prefix+name, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := checkRemoteResponse(resp, "delete", name); err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// target returns the URL of a path relative to the collection, each segment is escaped on its own so "/" separates collections
+func (w *webdavRemote) target(relative string) string {
+	segments := strings.Split(relative, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.TrimSuffix(w.config.Url, "/") + "/" + strings.Join(segments, "/")
+}
+
+// do sends a request for a path relative to the collection, an empty path addresses the collection itself
+func (w *webdavRemote) do(method, relative string, headers map[string]string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, w.target(relative), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	if len(w.config.Username) > 0 {
+		req.SetBasicAuth(w.config.Username, w.config.Password)
+	}
+	return w.client.Do(req)
+}
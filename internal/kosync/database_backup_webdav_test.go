@@ -0,0 +1,195 @@
+//
+// File:        internal/kosync/database_backup_webdav_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"encoding/xml"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testWebdavServer is a minimal WebDAV stand-in below /dav/, files can only be stored in existing collections
+type testWebdavServer struct {
+	lock        sync.Mutex
+	collections map[string]bool   // Paths of the collections with a trailing "/", the root is ""
+	files       map[string][]byte // Paths of the files relative to /dav/
+}
+
+func newTestWebdavServer(t *testing.T, collections ...string) (*testWebdavServer, *httptest.Server) {
+	dav := &testWebdavServer{collections: map[string]bool{"": true}, files: make(map[string][]byte)}
+	for _, collection := range collections {
+		dav.collections[collection] = true
+	}
+	server := httptest.NewServer(dav)
+	t.Cleanup(server.Close)
+	return dav, server
+}
+
+func (dav *testWebdavServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	dav.lock.Lock()
+	defer dav.lock.Unlock()
+
+	if username, password, _ := r.BasicAuth(); username != "kosync" || password != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	name, found := strings.CutPrefix(r.URL.Path, "/dav/")
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "PROPFIND":
+		dav.propfind(w, name)
+	case http.MethodPut:
+		if directory, _ := path.Split(name); !dav.collections[directory] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		dav.files[name], _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		data, found := dav.files[name]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	case http.MethodDelete:
+		delete(dav.files, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// propfind lists the collection and its direct members with Depth 1, hrefs are escaped like Nextcloud does
+func (dav *testWebdavServer) propfind(w http.ResponseWriter, collection string) {
+	if !dav.collections[collection] {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	members := []string{collection}
+	for name := range dav.collections {
+		if directory, _ := path.Split(strings.TrimSuffix(name, "/")); len(name) > 0 && directory == collection {
+			members = append(members, name)
+		}
+	}
+	for name := range dav.files {
+		if directory, _ := path.Split(name); directory == collection {
+			members = append(members, name)
+		}
+	}
+	sort.Strings(members)
+
+	type response struct {
+		Href string `xml:"href"`
+	}
+	result := struct {
+		XMLName   xml.Name   `xml:"DAV: multistatus"`
+		Responses []response `xml:"response"`
+	}{}
+	for _, member := range members {
+		href := (&url.URL{Path: "/dav/" + member}).EscapedPath()
+		result.Responses = append(result.Responses, response{strings.ReplaceAll(href, ":", "%3A")})
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusMultiStatus)
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+func testWebdavRemote(url, prefix string) BackupRemoteData {
+	return BackupRemoteData{Type: BackupRemoteWebdav, Url: url + "/dav", Prefix: prefix, Username: "kosync", Password: "secret"}
+}
+
+func TestWebdavRemote(t *testing.T) {
+	dav, server := newTestWebdavServer(t, "kosync/", "kosync/nested/")
+	remote, err := NewBackupRemote(testWebdavRemote(server.URL, "kosync/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{"database_2026-01-01-00:00:00.bak", "database_2026-01-02-00:00:00.bak", "database_2026-01-03-00:00:00.bak"}
+	for _, name := range names {
+		if err := remote.Upload(name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The prefix is a collection, so its "/" must not be escaped
+	if _, found := dav.files["kosync/"+names[0]]; !found {
+		t.Fatalf("Upload stored the files %v", slices.Sorted(maps.Keys(dav.files)))
+	}
+	// Files outside of the collection or in collections below it are not backups of this server
+	dav.files["database_2026-01-01-00:00:00.bak"] = nil
+	dav.files["kosync/nested/database_2026-01-01-00:00:00.bak"] = nil
+
+	listed, err := remote.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(listed, names) {
+		t.Errorf("List returned %v, expected %v", listed, names)
+	}
+
+	data, err := remote.Download(names[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != names[1] {
+		t.Errorf("Download returned %q, expected %q", data, names[1])
+	}
+	if err := remote.Delete(names[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remote.Download(names[1]); err == nil {
+		t.Error("Download of a deleted backup succeeded")
+	}
+}
+
+func TestWebdavRemoteListsTheFilePrefix(t *testing.T) {
+	dav, server := newTestWebdavServer(t, "kosync/")
+	dav.files["kosync/home_database_2026-01-01-00:00:00.bak"] = nil
+	dav.files["kosync/work_database_2026-01-01-00:00:00.bak"] = nil
+
+	remote, err := NewBackupRemote(testWebdavRemote(server.URL, "kosync/home_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed, err := remote.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"database_2026-01-01-00:00:00.bak"}; !slices.Equal(listed, expected) {
+		t.Errorf("List returned %v, expected %v", listed, expected)
+	}
+}
+
+func TestWebdavRemoteRejectsWrongPassword(t *testing.T) {
+	_, server := newTestWebdavServer(t)
+	config := testWebdavRemote(server.URL, "")
+	config.Password = "wrong"
+	remote, err := NewBackupRemote(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Upload("database_2026-01-01-00:00:00.bak", nil); err == nil {
+		t.Error("Upload with a wrong password succeeded")
+	}
+	if _, err := remote.List(); err == nil {
+		t.Error("List with a wrong password succeeded")
+	}
+}
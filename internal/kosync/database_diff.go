@@ -0,0 +1,117 @@
+//
+// File:        internal/kosync/database_diff.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// diffValueLength is the longest value shown in a change, longer values are shortened
+const diffValueLength = 60
+
+// StructuralChange is a change of a value in the JSON representation of the database
+type StructuralChange struct {
+	Path   string `json:"path"`   // JSON Pointer of the changed value, like /users/alice/aliases
+	Change string `json:"change"` // One of RestoreChangeAdded, RestoreChangeRemoved or RestoreChangeUpdated
+	Before any    `json:"before,omitempty"`
+	After  any    `json:"after,omitempty"`
+}
+
+func (c StructuralChange) String() string {
+	switch c.Change {
+	case RestoreChangeAdded:
+		return fmt.Sprintf("+ %s: %s", c.Path, diffValue(c.After))
+	case RestoreChangeRemoved:
+		return fmt.Sprintf("- %s: %s", c.Path, diffValue(c.Before))
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Path, diffValue(c.Before), diffValue(c.After))
+	}
+}
+
+// DiffJson compares two JSON documents and returns the changed values sorted by path.
+// Objects are compared key by key and arrays index by index, everything else by value.
+func DiffJson(before, after []byte) ([]StructuralChange, error) {
+	var beforeValue, afterValue any
+	if err := json.Unmarshal(before, &beforeValue); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(after, &afterValue); err != nil {
+		return nil, err
+	}
+
+	changes := diffJsonValue("", beforeValue, afterValue, make([]StructuralChange, 0))
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+func diffJsonValue(path string, before, after any, changes []StructuralChange) []StructuralChange {
+	switch beforeValue := before.(type) {
+	case map[string]any:
+		afterValue, ok := after.(map[string]any)
+		if !ok {
+			break
+		}
+		for key, value := range beforeValue {
+			if other, found := afterValue[key]; found {
+				changes = diffJsonValue(path+"/"+escapeJsonPointer(key), value, other, changes)
+			} else {
+				changes = append(changes, StructuralChange{Path: path + "/" + escapeJsonPointer(key), Change: RestoreChangeRemoved, Before: value})
+			}
+		}
+		for key, value := range afterValue {
+			if _, found := beforeValue[key]; !found {
+				changes = append(changes, StructuralChange{Path: path + "/" + escapeJsonPointer(key), Change: RestoreChangeAdded, After: value})
+			}
+		}
+		return changes
+	case []any:
+		afterValue, ok := after.([]any)
+		if !ok {
+			break
+		}
+		for i := 0; i < len(beforeValue) || i < len(afterValue); i++ {
+			elementPath := path + "/" + strconv.Itoa(i)
+			switch {
+			case i >= len(afterValue):
+				changes = append(changes, StructuralChange{Path: elementPath, Change: RestoreChangeRemoved, Before: beforeValue[i]})
+			case i >= len(beforeValue):
+				changes = append(changes, StructuralChange{Path: elementPath, Change: RestoreChangeAdded, After: afterValue[i]})
+			default:
+				changes = diffJsonValue(elementPath, beforeValue[i], afterValue[i], changes)
+			}
+		}
+		return changes
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		changes = append(changes, StructuralChange{Path: path, Change: RestoreChangeUpdated, Before: before, After: after})
+	}
+	return changes
+}
+
+// escapeJsonPointer escapes a key for a JSON Pointer as described in RFC 6901
+func escapeJsonPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+func diffValue(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	if len(data) > diffValueLength {
+		return string(data[:diffValueLength-3]) + "..."
+	}
+	return string(data)
+}
@@ -0,0 +1,491 @@
+//
+// File:        internal/kosync/database_export.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ExportFormatJsonl = "jsonl"
+	ExportFormatCsv   = "csv"
+	ExportFormatRedis = "redis" // Key layout of the KOReader sync server as RESP commands
+	ExportFormatRdb   = "rdb"   // Redis dump of the KOReader sync server, import only
+
+	ExportRecordConfig   = "config"
+	ExportRecordUser     = "user"
+	ExportRecordDocument = "document"
+	ExportRecordHistory  = "history"
+)
+
+var exportCsvHeader = []string{"type", "username", "document", "timestamp", "percentage", "progress", "device", "device_id", "pretty_name", "title", "authors", "series", "tags", "notes", "cover_url", "status"}
+
+// ExportRecord is one line of an export, which fields are set depends on the type
+type ExportRecord struct {
+	Type          string            `json:"type"` // One of ExportRecordConfig, ExportRecordUser, ExportRecordDocument or ExportRecordHistory
+	Username      string            `json:"username,omitempty"`
+	Password      string            `json:"password,omitempty"`
+	IsAdmin       bool              `json:"is_admin,omitempty"`
+	IsTenantAdmin bool              `json:"is_tenant_admin,omitempty"`
+	Aliases       map[string]string `json:"aliases,omitempty"`
+	Webhooks      []WebhookData     `json:"webhooks,omitempty"`
+	DocumentId    string            `json:"document_id,omitempty"`
+	Entry         *FileData         `json:"entry,omitempty"` // Progress of document and history records
+	Config        *ConfigData       `json:"config,omitempty"`
+}
+
+type ImportResultData struct {
+	Users     int      `json:"users"`     // Created users
+	Documents int      `json:"documents"` // Created or updated documents
+	History   int      `json:"history"`   // Added history entries
+	Skipped   int      `json:"skipped"`   // Records that were not imported
+	Warnings  []string `json:"warnings"`
+}
+
+// ExportFormatOfFile guesses the export format from the extension of a file name
+func ExportFormatOfFile(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return ExportFormatCsv
+	case ".resp", ".redis":
+		return ExportFormatRedis
+	case ".rdb":
+		return ExportFormatRdb
+	default:
+		return ExportFormatJsonl
+	}
+}
+
+// ExportContentType returns the content type of an export format
+func ExportContentType(format string) string {
+	switch format {
+	case ExportFormatCsv:
+		return "text/csv"
+	case ExportFormatRedis:
+		return "application/octet-stream"
+	default:
+		return "application/jsonl"
+	}
+}
+
+// ExportRecords lists the config, users, documents and history of the database sorted by user and document
+func ExportRecords(db Database) []ExportRecord {
+	config := db.Config
+	records := []ExportRecord{{Type: ExportRecordConfig, Config: &config}}
+
+	usernames := make([]string, 0, len(db.Users))
+	for username := range db.Users {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+
+	for _, username := range usernames {
+		user := db.Users[username]
+		records = append(records, ExportRecord{
+			Type:          ExportRecordUser,
+			Username:      username,
+			Password:      user.Password,
+			IsAdmin:       user.IsAdmin,
+			IsTenantAdmin: user.IsTenantAdmin,
+			Aliases:       user.Aliases,
+			Webhooks:      user.Webhooks,
+		})
+
+		documentIds := make([]string, 0, len(user.Documents))
+		for documentId := range user.Documents {
+			documentIds = append(documentIds, documentId)
+		}
+		sort.Strings(documentIds)
+		for _, documentId := range documentIds {
+			document := user.Documents[documentId]
+			records = append(records, ExportRecord{Type: ExportRecordDocument, Username: username, DocumentId: documentId, Entry: &document})
+			for _, entry := range user.History[documentId].DocumentHistory {
+				// The first history entry of a document is empty
+				if entry.Timestamp == 0 {
+					continue
+				}
+				records = append(records, ExportRecord{Type: ExportRecordHistory, Username: username, DocumentId: documentId, Entry: &entry})
+			}
+		}
+	}
+	return records
+}
+
+// WriteExport writes the records in the export format, records the format can not represent are left out
+func WriteExport(w io.Writer, records []ExportRecord, format string) error {
+	switch format {
+	case ExportFormatJsonl:
+		encoder := json.NewEncoder(w)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	case ExportFormatCsv:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(exportCsvHeader); err != nil {
+			return err
+		}
+		for _, record := range records {
+			if record.Entry == nil {
+				continue
+			}
+			entry := record.Entry
+			err := writer.Write([]string{
+				record.Type, record.Username, record.DocumentId,
+				strconv.FormatInt(entry.Timestamp, 10),
+				strconv.FormatFloat(float64(entry.Percentage), 'f', -1, 32),
+				entry.Progress, entry.Device, entry.DeviceId, entry.PrettyName,
+				entry.Metadata.Title, strings.Join(entry.Metadata.Authors, "; "), entry.Metadata.Series,
+				strings.Join(entry.Metadata.Tags, "; "), entry.Metadata.Notes, entry.Metadata.CoverUrl, entry.Metadata.Status,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case ExportFormatRedis:
+		for _, record := range records {
+			var err error
+			switch record.Type {
+			case ExportRecordUser:
+				err = writeRespCommand(w, "SET", fmt.Sprintf("user:%s:key", record.Username), record.Password)
+			case ExportRecordDocument:
+				err = writeRespCommand(w, "HSET", fmt.Sprintf("user:%s:document:%s", record.Username, record.DocumentId),
+					"percentage", strconv.FormatFloat(float64(record.Entry.Percentage), 'f', -1, 32),
+					"progress", record.Entry.Progress,
+					"device", record.Entry.Device,
+					"device_id", record.Entry.DeviceId,
+					"timestamp", strconv.FormatInt(record.Entry.Timestamp, 10))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("export format '%s' is not supported, available are %s, %s and %s", format, ExportFormatJsonl, ExportFormatCsv, ExportFormatRedis)
+	}
+}
+
+// ReadImport reads the records of an export, nothing is applied to a database
+func ReadImport(r io.Reader, format string) ([]ExportRecord, error) {
+	records := make([]ExportRecord, 0)
+	switch format {
+	case ExportFormatJsonl:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if len(strings.TrimSpace(scanner.Text())) == 0 {
+				continue
+			}
+			var record ExportRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			records = append(records, record)
+		}
+		return records, scanner.Err()
+	case ExportFormatCsv:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = len(exportCsvHeader)
+		rows, err := reader.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for i, row := range rows {
+			if i == 0 && row[0] == exportCsvHeader[0] {
+				continue
+			}
+			record, err := csvExportRecord(row)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			records = append(records, record)
+		}
+		return records, nil
+	case ExportFormatRedis:
+		reader := bufio.NewReader(r)
+		for {
+			value, err := readRespValue(reader)
+			if err == io.EOF {
+				return records, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			command, err := respStrings(value)
+			if err != nil {
+				return nil, err
+			}
+			if record, ok := redisExportRecord(command); ok {
+				records = append(records, record)
+			}
+		}
+	case ExportFormatRdb:
+		return ReadRdbRecords(r)
+	default:
+		return nil, fmt.Errorf("import format '%s' is not supported, available are %s, %s, %s and %s", format, ExportFormatJsonl, ExportFormatCsv, ExportFormatRedis, ExportFormatRdb)
+	}
+}
+
+func csvExportRecord(row []string) (ExportRecord, error) {
+	if row[0] != ExportRecordDocument && row[0] != ExportRecordHistory {
+		return ExportRecord{}, fmt.Errorf("unknown record type '%s'", row[0])
+	}
+	timestamp, err := strconv.ParseInt(row[3], 10, 64)
+	if err != nil {
+		return ExportRecord{}, fmt.Errorf("invalid timestamp '%s'", row[3])
+	}
+	percentage, err := strconv.ParseFloat(row[4], 32)
+	if err != nil {
+		return ExportRecord{}, fmt.Errorf("invalid percentage '%s'", row[4])
+	}
+	return ExportRecord{
+		Type:       row[0],
+		Username:   row[1],
+		DocumentId: row[2],
+		Entry: &FileData{
+			ProgressData: ProgressData{Percentage: float32(percentage), Progress: row[5], Device: row[6], DeviceId: row[7]},
+			DocumentId:   row[2],
+			Timestamp:    timestamp,
+			PrettyName:   row[8],
+			Metadata: DocumentMetadata{
+				Title:    row[9],
+				Authors:  normalizeList(strings.Split(row[10], ";")),
+				Series:   row[11],
+				Tags:     normalizeList(strings.Split(row[12], ";")),
+				Notes:    row[13],
+				CoverUrl: row[14],
+				Status:   row[15],
+			},
+		},
+	}, nil
+}
+
+// redisExportRecord converts a SET or HSET command of the KOReader sync server key layout, other commands are ignored
+func redisExportRecord(command []string) (ExportRecord, bool) {
+	if len(command) < 3 {
+		return ExportRecord{}, false
+	}
+	switch strings.ToUpper(command[0]) {
+	case "SET":
+		return redisUserRecord(command[1], command[2])
+	case "HSET", "HMSET":
+		fields := make(map[string]string)
+		for i := 2; i+1 < len(command); i += 2 {
+			fields[command[i]] = command[i+1]
+		}
+		return redisDocumentRecord(command[1], fields)
+	default:
+		return ExportRecord{}, false
+	}
+}
+
+// redisUserRecord converts the value of a user:<username>:key key
+func redisUserRecord(key, value string) (ExportRecord, bool) {
+	rest, found := strings.CutPrefix(key, "user:")
+	if !found {
+		return ExportRecord{}, false
+	}
+	username, found := strings.CutSuffix(rest, ":key")
+	if !found || len(username) == 0 {
+		return ExportRecord{}, false
+	}
+	return ExportRecord{Type: ExportRecordUser, Username: username, Password: value}, true
+}
+
+// redisDocumentRecord converts the hash of a user:<username>:document:<document> key
+func redisDocumentRecord(key string, fields map[string]string) (ExportRecord, bool) {
+	rest, found := strings.CutPrefix(key, "user:")
+	if !found {
+		return ExportRecord{}, false
+	}
+	separator := strings.LastIndex(rest, ":document:")
+	if separator < 0 {
+		return ExportRecord{}, false
+	}
+	username, documentId := rest[:separator], rest[separator+len(":document:"):]
+
+	percentage, _ := strconv.ParseFloat(fields["percentage"], 32)
+	timestamp, _ := strconv.ParseInt(fields["timestamp"], 10, 64)
+	return ExportRecord{
+		Type:       ExportRecordDocument,
+		Username:   username,
+		DocumentId: documentId,
+		Entry: &FileData{
+			ProgressData: ProgressData{
+				Percentage: float32(percentage),
+				Progress:   fields["progress"],
+				Device:     fields["device"],
+				DeviceId:   fields["device_id"],
+			},
+			DocumentId: documentId,
+			Timestamp:  timestamp,
+		},
+	}, true
+}
+
+// ApplyImport merges the records into the database.
+// Users are created when they do not exist, existing users keep their password.
+// Documents are replaced when the imported progress is not older, history entries are added when they are missing.
+func ApplyImport(db *Database, records []ExportRecord) ImportResultData {
+	result := ImportResultData{Warnings: make([]string, 0)}
+	if db.Users == nil {
+		db.Users = make(map[string]UserData)
+	}
+
+	// Users are created first, dumps of Redis are not ordered
+	records = slices.Clone(records)
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Type == ExportRecordUser && records[j].Type != ExportRecordUser
+	})
+
+	for _, record := range records {
+		switch record.Type {
+		case ExportRecordConfig:
+			// The config of the target database is kept
+			continue
+		case ExportRecordUser:
+			if _, found := db.Users[record.Username]; found || len(record.Username) == 0 {
+				continue
+			}
+			tenant, username := db.SplitUserKey(record.Username)
+			user := UserData{
+				Username:      username,
+				Password:      record.Password,
+				Documents:     make(map[string]FileData),
+				History:       make(map[string]HistoryData),
+				Aliases:       record.Aliases,
+				Webhooks:      record.Webhooks,
+				IsAdmin:       record.IsAdmin,
+				Tenant:        tenant,
+				IsTenantAdmin: record.IsTenantAdmin && len(tenant) > 0,
+			}
+			if user.Aliases == nil {
+				user.Aliases = make(map[string]string)
+			}
+			if user.Webhooks == nil {
+				user.Webhooks = make([]WebhookData, 0)
+			}
+			db.Users[record.Username] = user
+			result.Users++
+		case ExportRecordDocument, ExportRecordHistory:
+			user, found := db.Users[record.Username]
+			if !found || record.Entry == nil || len(record.DocumentId) == 0 {
+				result.Skipped++
+				result.Warnings = append(result.Warnings, fmt.Sprintf("skipped %s '%s' of unknown user '%s'", record.Type, record.DocumentId, record.Username))
+				continue
+			}
+			if err := (DocumentData{ProgressData: record.Entry.ProgressData, Document: record.DocumentId}).validateStored(); err != nil {
+				result.Skipped++
+				result.Warnings = append(result.Warnings, fmt.Sprintf("skipped %s '%s' of user '%s': %v", record.Type, record.DocumentId, record.Username, err))
+				continue
+			}
+			if user.Documents == nil {
+				user.Documents = make(map[string]FileData)
+			}
+			if user.History == nil {
+				user.History = make(map[string]HistoryData)
+			}
+
+			entry := *record.Entry
+			entry.DocumentId = record.DocumentId
+			if record.Type == ExportRecordHistory {
+				history := user.History[record.DocumentId].DocumentHistory
+				// History entries are the same when they have the same progress at the same time
+				duplicate := slices.ContainsFunc(history, func(existing FileData) bool {
+					return existing.Timestamp == entry.Timestamp && existing.ProgressData == entry.ProgressData
+				})
+				if !duplicate {
+					history = append(history, entry)
+					sort.SliceStable(history, func(i, j int) bool {
+						return history[i].Timestamp < history[j].Timestamp
+					})
+					history = db.Config.Limits.TrimHistory(history)
+					user.History[record.DocumentId] = HistoryData{DocumentHistory: history}
+					result.History++
+				}
+			} else {
+				current, found := user.Documents[record.DocumentId]
+				if found && current.Timestamp > entry.Timestamp {
+					continue
+				}
+				if err := db.CheckDocumentLimit(user, record.DocumentId); err != nil {
+					result.Skipped++
+					result.Warnings = append(result.Warnings, fmt.Sprintf("skipped %s '%s' of user '%s': %v", record.Type, record.DocumentId, record.Username, err))
+					continue
+				}
+				// Formats without metadata keep the metadata of the current document
+				if len(entry.Metadata.Status) == 0 {
+					entry.PrettyName = current.PrettyName
+					entry.Metadata = current.Metadata
+				}
+				if len(entry.Metadata.Status) == 0 {
+					entry.Metadata = DocumentMetadata{Authors: make([]string, 0), Tags: make([]string, 0), Status: DocumentStatusReading}
+					if entry.Percentage >= FinishedPercentage {
+						entry.Metadata.Status = DocumentStatusFinished
+					}
+				}
+				user.Documents[record.DocumentId] = entry
+				result.Documents++
+			}
+			db.Users[record.Username] = user
+		default:
+			result.Skipped++
+			result.Warnings = append(result.Warnings, fmt.Sprintf("skipped record of unknown type '%s'", record.Type))
+		}
+	}
+	return result
+}
+
+// ImportRecords applies the records to the database of the server, a backup is created first unless it is a dry run
+func (app *Kosync) ImportRecords(records []ExportRecord, dryRun bool) (ImportResultData, error) {
+	if dryRun {
+		app.LockDb()
+		defer app.DbLock.Unlock()
+		// Apply to a copy, ApplyImport changes the maps of the users and appends to and sorts the history in place
+		db := Database{Config: app.Db.Config, Users: make(map[string]UserData, len(app.Db.Users))}
+		for username, user := range app.Db.Users {
+			user.Documents = maps.Clone(user.Documents)
+			user.History = make(map[string]HistoryData, len(user.History))
+			for documentId, history := range app.Db.Users[username].History {
+				user.History[documentId] = HistoryData{DocumentHistory: slices.Clone(history.DocumentHistory)}
+			}
+			db.Users[username] = user
+		}
+		return ApplyImport(&db, records), nil
+	}
+
+	if _, err := app.BackupDatabase(); err != nil {
+		return ImportResultData{}, fmt.Errorf("failed to backup the current database: %w", err)
+	}
+
+	app.LockDb()
+	defer app.DbLock.Unlock()
+	result := ApplyImport(&app.Db, records)
+	if err := app.PersistDatabase(); err != nil {
+		return ImportResultData{}, err
+	}
+
+	app.ClearStats()
+
+	app.Logger("DB").Info("Imported records", "users", result.Users, "documents", result.Documents, "history", result.History, "skipped", result.Skipped)
+	return result, nil
+}
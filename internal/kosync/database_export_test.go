@@ -0,0 +1,108 @@
+//
+// File:        internal/kosync/database_export_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestApplyImportSkipsInvalidDocuments(t *testing.T) {
+	app := newTestApp(t)
+	entry := func(percentage float32) *FileData {
+		return &FileData{ProgressData: ProgressData{Percentage: percentage, Progress: "p", Device: "d"}, Timestamp: 1700000000}
+	}
+	records := []ExportRecord{
+		{Type: ExportRecordUser, Username: "alice", Password: testUserKey},
+		{Type: ExportRecordDocument, Username: "alice", DocumentId: "0123456789abcdef0123456789abcdef", Entry: entry(0.5)},
+		{Type: ExportRecordDocument, Username: "alice", DocumentId: "../../etc/passwd", Entry: entry(0.5)},
+		{Type: ExportRecordDocument, Username: "alice", DocumentId: "fedcba9876543210fedcba9876543210", Entry: entry(float32(math.NaN()))},
+		{Type: ExportRecordHistory, Username: "alice", DocumentId: "0123456789abcdef0123456789abcdef", Entry: entry(2)},
+	}
+
+	result := ApplyImport(&app.Db, records)
+	if result.Users != 1 || result.Documents != 1 || result.History != 0 || result.Skipped != 3 || len(result.Warnings) != 3 {
+		t.Errorf("result is %+v", result)
+	}
+	if documents := app.Db.Users["alice"].Documents; len(documents) != 1 {
+		t.Errorf("imported documents are %v", documents)
+	}
+}
+
+func TestImportDryRunKeepsTheDatabase(t *testing.T) {
+	const documentId = "0123456789abcdef0123456789abcdef"
+	app := newTestApp(t)
+	addTestUser(app, "", "alice")
+	// History read from the database file has spare capacity, the dry run must not append into it
+	history := make([]FileData, 2, 4)
+	history[0] = FileData{ProgressData: ProgressData{Percentage: 0.1, Progress: "a", Device: "d"}, DocumentId: documentId, Timestamp: 100}
+	history[1] = FileData{ProgressData: ProgressData{Percentage: 0.3, Progress: "c", Device: "d"}, DocumentId: documentId, Timestamp: 300}
+	app.Db.Users["alice"].History[documentId] = HistoryData{DocumentHistory: history}
+	app.Db.Users["alice"].Documents[documentId] = history[1]
+	before, err := json.Marshal(app.Db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []ExportRecord{
+		{Type: ExportRecordUser, Username: "bob", Password: testUserKey},
+		{Type: ExportRecordHistory, Username: "alice", DocumentId: documentId,
+			Entry: &FileData{ProgressData: ProgressData{Percentage: 0.2, Progress: "b", Device: "d"}, Timestamp: 200}},
+		{Type: ExportRecordDocument, Username: "alice", DocumentId: documentId,
+			Entry: &FileData{ProgressData: ProgressData{Percentage: 0.4, Progress: "d", Device: "d"}, Timestamp: 400}},
+	}
+	result, err := app.ImportRecords(records, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Users != 1 || result.History != 1 || result.Documents != 1 {
+		t.Errorf("result is %+v", result)
+	}
+
+	after, err := json.Marshal(app.Db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Errorf("the dry run changed the database:\n%s\nexpected\n%s", after, before)
+	}
+	if history[:3][2].Timestamp != 0 {
+		t.Error("the dry run wrote into the spare capacity of the history")
+	}
+}
+
+func TestApplyImportEnforcesLimits(t *testing.T) {
+	app := newTestApp(t)
+	app.Db.Config.Limits.MaxDocuments = 2
+	app.Db.Config.Limits.MaxHistoryEntries = 3
+	addTestUser(app, "", "alice")
+
+	var records []ExportRecord
+	for i := range 3 {
+		records = append(records, ExportRecord{Type: ExportRecordDocument, Username: "alice", DocumentId: fmt.Sprintf("%032x", i),
+			Entry: &FileData{ProgressData: ProgressData{Percentage: 0.5, Progress: "p", Device: "d"}, Timestamp: 1700000000}})
+	}
+	for i := range 5 {
+		records = append(records, ExportRecord{Type: ExportRecordHistory, Username: "alice", DocumentId: fmt.Sprintf("%032x", 0),
+			Entry: &FileData{ProgressData: ProgressData{Percentage: 0.1 * float32(i), Progress: "p", Device: "d"}, Timestamp: int64(1700000000 + i)}})
+	}
+
+	result := ApplyImport(&app.Db, records)
+	if result.Documents != 2 || result.Skipped != 1 {
+		t.Errorf("result is %+v", result)
+	}
+	alice := app.Db.Users["alice"]
+	if len(alice.Documents) != 2 {
+		t.Errorf("alice has %d documents", len(alice.Documents))
+	}
+	history := alice.History[fmt.Sprintf("%032x", 0)].DocumentHistory
+	if len(history) != 3 || history[0].Timestamp != 1700000002 {
+		t.Errorf("history is %+v", history)
+	}
+}
@@ -6,56 +6,115 @@
 
 package kosync
 
-import "fmt"
+import (
+	"fmt"
+)
 
 const (
-	SchemaVersion = 6
+	SchemaVersion = 18
 )
 
-func (app *Kosync) MigrateSchema() error {
-	app.PrintDebug("DB", "-", "Checking for Database schema migrations.")
+// Migration changes the database from schema Version-1 to Version with Up and back with Down
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(db *Database) error
+	Down    func(db *Database) error // nil for migrations that can not be reverted
+}
 
-	migrations := map[int]interface{}{
-		1: func() {
-			// Add history to users
-			for id, user := range app.Db.Users {
-				app.Db.Users[id] = UserData{
+// Migrations are ordered by version, the last one is the SchemaVersion
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "Add history to users",
+		Up: func(db *Database) error {
+			for id, user := range db.Users {
+				db.Users[id] = UserData{
 					Username:  user.Username,
 					Password:  user.Password,
 					Documents: user.Documents,
 					History:   make(map[string]HistoryData),
 				}
 			}
+			return nil
+		},
+		Down: func(db *Database) error {
+			for id, user := range db.Users {
+				user.History = nil
+				db.Users[id] = user
+			}
+			return nil
 		},
-		2: func() {
-			// Default backup encoding to msgpack
-			app.Db.Config.BackupEncodingType = BackupEncodingTypeMsgpack
+	},
+	{
+		Version: 2,
+		Name:    "Default backup encoding to msgpack",
+		Up: func(db *Database) error {
+			db.Config.BackupEncodingType = BackupEncodingTypeMsgpack
+			return nil
 		},
-		3: func() {
-			// Disable backup on startup
-			app.Db.Config.BackupOnStartup = false
+		Down: func(db *Database) error {
+			db.Config.BackupEncodingType = ""
+			return nil
 		},
-		4: func() {
-			// Add document id to documents
-			for userId, user := range app.Db.Users {
+	},
+	{
+		Version: 3,
+		Name:    "Disable backup on startup",
+		Up: func(db *Database) error {
+			db.Config.BackupOnStartup = false
+			return nil
+		},
+		Down: func(db *Database) error {
+			db.Config.BackupOnStartup = false
+			return nil
+		},
+	},
+	{
+		Version: 4,
+		Name:    "Add document id to documents",
+		Up: func(db *Database) error {
+			for userId, user := range db.Users {
 				for docId, doc := range user.Documents {
-					app.Db.Users[userId].Documents[docId] = FileData{
+					db.Users[userId].Documents[docId] = FileData{
 						DocumentId:   docId,
 						ProgressData: doc.ProgressData,
 						Timestamp:    doc.Timestamp,
 					}
 				}
 			}
+			return nil
+		},
+		Down: func(db *Database) error {
+			for _, user := range db.Users {
+				for docId, doc := range user.Documents {
+					doc.DocumentId = ""
+					user.Documents[docId] = doc
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 5,
+		Name:    "Disable webui",
+		Up: func(db *Database) error {
+			db.Config.WebUi = false
+			return nil
 		},
-		5: func() {
-			// Disable webui
-			app.Db.Config.WebUi = false
+		Down: func(db *Database) error {
+			db.Config.WebUi = false
+			return nil
 		},
-		6: func() {
+	},
+	{
+		Version: 6,
+		Name:    "Add pretty name to documents",
+		Up: func(db *Database) error {
 			// Set an empty pretty name to documents (because string can't be nil)
-			for userId, user := range app.Db.Users {
+			for userId, user := range db.Users {
 				for docId, doc := range user.Documents {
-					app.Db.Users[userId].Documents[docId] = FileData{
+					db.Users[userId].Documents[docId] = FileData{
 						DocumentId:   docId,
 						ProgressData: doc.ProgressData,
 						Timestamp:    doc.Timestamp,
@@ -63,26 +122,300 @@ func (app *Kosync) MigrateSchema() error {
 					}
 				}
 			}
+			return nil
+		},
+		Down: func(db *Database) error {
+			for _, user := range db.Users {
+				for docId, doc := range user.Documents {
+					doc.PrettyName = ""
+					user.Documents[docId] = doc
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 7,
+		Name:    "Add metadata to documents",
+		Up: func(db *Database) error {
+			// The title defaults to the pretty name
+			for userId, user := range db.Users {
+				for docId, doc := range user.Documents {
+					status := DocumentStatusReading
+					if doc.Percentage >= FinishedPercentage {
+						status = DocumentStatusFinished
+					}
+					doc.Metadata = DocumentMetadata{
+						Title:   doc.PrettyName,
+						Authors: make([]string, 0),
+						Tags:    make([]string, 0),
+						Status:  status,
+					}
+					db.Users[userId].Documents[docId] = doc
+				}
+			}
+			return nil
+		},
+		Down: func(db *Database) error {
+			for _, user := range db.Users {
+				for docId, doc := range user.Documents {
+					doc.Metadata = DocumentMetadata{}
+					user.Documents[docId] = doc
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 8,
+		Name:    "Add document aliases to users",
+		Up: func(db *Database) error {
+			for id, user := range db.Users {
+				user.Aliases = make(map[string]string)
+				db.Users[id] = user
+			}
+			return nil
+		},
+		Down: func(db *Database) error {
+			for id, user := range db.Users {
+				user.Aliases = nil
+				db.Users[id] = user
+			}
+			return nil
+		},
+	},
+	{
+		Version: 9,
+		Name:    "Add webhooks to config and users",
+		Up: func(db *Database) error {
+			db.Config.Webhooks = make([]WebhookData, 0)
+			for id, user := range db.Users {
+				user.Webhooks = make([]WebhookData, 0)
+				db.Users[id] = user
+			}
+			return nil
+		},
+		Down: func(db *Database) error {
+			db.Config.Webhooks = nil
+			for id, user := range db.Users {
+				user.Webhooks = nil
+				db.Users[id] = user
+			}
+			return nil
+		},
+	},
+	{
+		Version: 10,
+		Name:    "Disable metrics",
+		Up: func(db *Database) error {
+			db.Config.Metrics = false
+			db.Config.MetricsAddress = ""
+			return nil
+		},
+		Down: func(db *Database) error {
+			db.Config.Metrics = false
+			db.Config.MetricsAddress = ""
+			return nil
+		},
+	},
+	{
+		Version: 11,
+		Name:    "Structured logging defaults to text on info level",
+		Up: func(db *Database) error {
+			db.Config.LogFormat = LogFormatText
+			db.Config.LogLevel = "info"
+			db.Config.LogLevels = make(map[string]string)
+			return nil
+		},
+		Down: func(db *Database) error {
+			db.Config.LogFormat = ""
+			db.Config.LogLevel = ""
+			db.Config.LogLevels = nil
+			return nil
+		},
+	},
+	{
+		Version: 12,
+		Name:    "No user is an admin by default",
+		Up: func(db *Database) error {
+			for id, user := range db.Users {
+				user.IsAdmin = false
+				db.Users[id] = user
+			}
+			return nil
 		},
+		Down: func(db *Database) error {
+			for id, user := range db.Users {
+				user.IsAdmin = false
+				db.Users[id] = user
+			}
+			return nil
+		},
+	},
+	{
+		Version: 13,
+		Name:    "Disable scheduled backups and keep all backups next to the database",
+		Up: func(db *Database) error {
+			db.Config.BackupSchedule = ""
+			db.Config.BackupRetention = BackupRetentionData{}
+			db.Config.BackupDirectory = ""
+			return nil
+		},
+		Down: func(db *Database) error {
+			db.Config.BackupSchedule = ""
+			db.Config.BackupRetention = BackupRetentionData{}
+			db.Config.BackupDirectory = ""
+			return nil
+		},
+	},
+	{
+		Version: 14,
+		Name:    "Backups stay uncompressed and unencrypted",
+		Up: func(db *Database) error {
+			db.Config.BackupCompression = ""
+			db.Config.BackupEncryption = ""
+			db.Config.BackupKeyFile = ""
+			return nil
+		},
+		Down: func(db *Database) error {
+			db.Config.BackupCompression = ""
+			db.Config.BackupEncryption = ""
+			db.Config.BackupKeyFile = ""
+			return nil
+		},
+	},
+	{
+		Version: 15,
+		Name:    "Backups are not uploaded anywhere",
+		Up: func(db *Database) error {
+			db.Config.BackupRemote = BackupRemoteData{}
+			return nil
+		},
+		Down: func(db *Database) error {
+			db.Config.BackupRemote = BackupRemoteData{}
+			return nil
+		},
+	},
+	{
+		Version: 16,
+		Name:    "Add tenants, all users are outside of tenants",
+		Up: func(db *Database) error {
+			db.Config.Tenants = make([]TenantData, 0)
+			for id, user := range db.Users {
+				user.Tenant = ""
+				user.IsTenantAdmin = false
+				db.Users[id] = user
+			}
+			return nil
+		},
+		Down: func(db *Database) error {
+			db.Config.Tenants = nil
+			// Users of tenants keep working with their scoped key as username
+			for id, user := range db.Users {
+				user.Username = id
+				user.Tenant = ""
+				user.IsTenantAdmin = false
+				db.Users[id] = user
+			}
+			return nil
+		},
+	},
+	{
+		Version: 17,
+		Name:    "Add limits, existing databases stay unlimited",
+		Up: func(db *Database) error {
+			// Only new databases are created with the DefaultLimits, clients of existing ones must not start failing
+			db.Config.Limits = LimitsData{}
+			return nil
+		},
+		Down: func(db *Database) error {
+			db.Config.Limits = LimitsData{}
+			return nil
+		},
+	},
+	{
+		Version: 18,
+		Name:    "Serve plain HTTP, TLS is left to a reverse proxy",
+		Up: func(db *Database) error {
+			db.Config.Tls = TlsData{Acme: AcmeData{Domains: make([]string, 0)}}
+			return nil
+		},
+		Down: func(db *Database) error {
+			db.Config.Tls = TlsData{}
+			return nil
+		},
+	},
+}
+
+// MigrateDatabase applies the Up or Down functions of the migrations until the database has the target schema.
+// After every step the schema of the database is updated and afterStep is called, when it is not nil.
+func MigrateDatabase(db *Database, target int, afterStep func(migration Migration, from, to int) error) error {
+	if target < 0 || target > SchemaVersion {
+		return fmt.Errorf("schema version %d does not exist, the latest is %d", target, SchemaVersion)
+	}
+	if db.Schema > SchemaVersion {
+		return fmt.Errorf("the database has schema version %d which is newer than the latest known version %d", db.Schema, SchemaVersion)
+	}
+
+	for _, migration := range Migrations {
+		if migration.Version <= db.Schema || migration.Version > target {
+			continue
+		}
+		from := db.Schema
+		if err := migration.Up(db); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+		db.Schema = migration.Version
+		if afterStep != nil {
+			if err := afterStep(migration, from, db.Schema); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := len(Migrations) - 1; i >= 0; i-- {
+		migration := Migrations[i]
+		if migration.Version > db.Schema || migration.Version <= target {
+			continue
+		}
+		if migration.Down == nil {
+			return fmt.Errorf("migration %d (%s) can not be reverted", migration.Version, migration.Name)
+		}
+		from := db.Schema
+		if err := migration.Down(db); err != nil {
+			return fmt.Errorf("reverting migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+		db.Schema = migration.Version - 1
+		if afterStep != nil {
+			if err := afterStep(migration, from, db.Schema); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
+}
+
+// MigrateSchema creates a backup and migrates the database to the current schema, every step is persisted
+func (app *Kosync) MigrateSchema() error {
+	app.Logger("DB").Debug("Checking for Database schema migrations")
 
 	if app.Db.Schema < SchemaVersion {
-		app.PrintDebug("DB", "-", "Migrations are available, performing backup.")
-		if err := app.BackupDatabase(); err != nil {
+		app.Logger("DB").Debug("Migrations are available, performing backup")
+		if _, err := app.BackupDatabase(); err != nil {
 			return err
 		}
 	} else {
-		app.PrintDebug("DB", "-", "No Migrations to do.")
+		app.Logger("DB").Debug("No Migrations to do")
 		return nil
 	}
 
-	for ver, migrate := range migrations {
-		if app.Db.Schema < ver {
-			app.PrintDebug("DB", "-", fmt.Sprintf("Migrating Schema from %d to %d", app.Db.Schema, ver))
-			migrate.(func())()
-			app.Db.Schema = ver
-		}
-	}
+	return app.MigrateSchemaTo(SchemaVersion)
+}
 
-	return nil
+// MigrateSchemaTo migrates the database up or down to the target schema and persists every step
+func (app *Kosync) MigrateSchemaTo(target int) error {
+	return MigrateDatabase(&app.Db, target, func(migration Migration, from, to int) error {
+		app.Logger("DB").Info("Migrated schema", "from", from, "to", to, "migration", migration.Name)
+		return app.PersistDatabase()
+	})
 }
@@ -0,0 +1,283 @@
+//
+// File:        internal/kosync/database_migration_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// The fixtures in testdata/migrations are databases of every schema version, schema_00.json is a database of the first release.
+// Every fixture is the previous fixture with one migration applied.
+
+func loadMigrationFixture(t *testing.T, version int) Database {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "migrations", fmt.Sprintf("schema_%02d.json", version)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var db Database
+	if err := json.Unmarshal(data, &db); err != nil {
+		t.Fatal(err)
+	}
+	if db.Schema != version {
+		t.Fatalf("fixture of schema %d has schema %d", version, db.Schema)
+	}
+	return db
+}
+
+// assertSameDatabase compares the databases as they would be written to the database file
+func assertSameDatabase(t *testing.T, actual, expected Database, context string) {
+	t.Helper()
+	actualJson, err := json.MarshalIndent(actual, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedJson, err := json.MarshalIndent(expected, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(actualJson) != string(expectedJson) {
+		t.Errorf("%s:\n%s\nexpected\n%s", context, actualJson, expectedJson)
+	}
+}
+
+func TestMigrationsAreOrdered(t *testing.T) {
+	for i, migration := range Migrations {
+		if migration.Version != i+1 {
+			t.Errorf("migration %q at index %d has version %d, expected %d", migration.Name, i, migration.Version, i+1)
+		}
+		if migration.Up == nil {
+			t.Errorf("migration %d has no Up function", migration.Version)
+		}
+	}
+	if last := Migrations[len(Migrations)-1].Version; last != SchemaVersion {
+		t.Errorf("the last migration has version %d, SchemaVersion is %d", last, SchemaVersion)
+	}
+}
+
+func TestMigrateUpFromEverySchema(t *testing.T) {
+	latest := loadMigrationFixture(t, SchemaVersion)
+
+	for version := 0; version <= SchemaVersion; version++ {
+		t.Run(fmt.Sprintf("schema %d", version), func(t *testing.T) {
+			db := loadMigrationFixture(t, version)
+			applied := make([]int, 0)
+			err := MigrateDatabase(&db, SchemaVersion, func(migration Migration, from, to int) error {
+				if from != migration.Version-1 || to != migration.Version || db.Schema != to {
+					t.Errorf("migration %d went from %d to %d with schema %d", migration.Version, from, to, db.Schema)
+				}
+				applied = append(applied, migration.Version)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := make([]int, 0)
+			for v := version + 1; v <= SchemaVersion; v++ {
+				expected = append(expected, v)
+			}
+			if !slices.Equal(applied, expected) {
+				t.Errorf("applied migrations %v, expected %v", applied, expected)
+			}
+			assertSameDatabase(t, db, latest, "migrated database")
+		})
+	}
+}
+
+func TestMigrateEveryStepUpAndDown(t *testing.T) {
+	for _, migration := range Migrations {
+		t.Run(fmt.Sprintf("migration %d", migration.Version), func(t *testing.T) {
+			before := loadMigrationFixture(t, migration.Version-1)
+			after := loadMigrationFixture(t, migration.Version)
+
+			db := loadMigrationFixture(t, migration.Version-1)
+			if err := MigrateDatabase(&db, migration.Version, nil); err != nil {
+				t.Fatal(err)
+			}
+			assertSameDatabase(t, db, after, "after Up")
+
+			if migration.Down == nil {
+				return
+			}
+			if err := MigrateDatabase(&db, migration.Version-1, nil); err != nil {
+				t.Fatal(err)
+			}
+			assertSameDatabase(t, db, before, "after Down")
+		})
+	}
+}
+
+func TestMigrateDownToFirstSchema(t *testing.T) {
+	db := loadMigrationFixture(t, SchemaVersion)
+	reverted := make([]int, 0)
+	err := MigrateDatabase(&db, 0, func(migration Migration, from, to int) error {
+		if from != migration.Version || to != migration.Version-1 {
+			t.Errorf("reverting migration %d went from %d to %d", migration.Version, from, to)
+		}
+		reverted = append(reverted, migration.Version)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := make([]int, 0)
+	for v := SchemaVersion; v > 0; v-- {
+		expected = append(expected, v)
+	}
+	if !slices.Equal(reverted, expected) {
+		t.Errorf("reverted migrations %v, expected %v", reverted, expected)
+	}
+	assertSameDatabase(t, db, loadMigrationFixture(t, 0), "reverted database")
+}
+
+func TestMigratedFields(t *testing.T) {
+	db := loadMigrationFixture(t, 0)
+	if err := MigrateDatabase(&db, SchemaVersion, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.Config.BackupEncodingType != BackupEncodingTypeMsgpack {
+		t.Errorf("backup_encoding_type is %q", db.Config.BackupEncodingType)
+	}
+	if db.Config.LogFormat != LogFormatText || db.Config.LogLevel != "info" {
+		t.Errorf("logging is %q on %q", db.Config.LogFormat, db.Config.LogLevel)
+	}
+	if db.Config.Webhooks == nil || db.Config.Tenants == nil || db.Config.LogLevels == nil {
+		t.Error("config lists are not initialized")
+	}
+	if !db.Config.DisableRegistration || !db.Config.StoreHistory || db.Config.ListenAddress != ":8080" {
+		t.Error("the config of the first schema was not kept")
+	}
+	// Clients of existing databases must not start failing
+	if db.Config.Limits != (LimitsData{}) {
+		t.Errorf("limits of an existing database are %+v", db.Config.Limits)
+	}
+
+	alice := db.Users["alice"]
+	if alice.Username != "alice" || alice.Password != "5f4dcc3b5aa765d61d8327deb882cf99" || alice.Tenant != "" {
+		t.Errorf("user is %q with password %q in tenant %q", alice.Username, alice.Password, alice.Tenant)
+	}
+	if alice.History == nil || alice.Aliases == nil || alice.Webhooks == nil {
+		t.Error("user maps are not initialized")
+	}
+	statuses := map[string]string{
+		"0123456789abcdef0123456789abcdef": DocumentStatusReading,
+		"fedcba9876543210fedcba9876543210": DocumentStatusFinished,
+	}
+	for docId, status := range statuses {
+		doc := alice.Documents[docId]
+		if doc.DocumentId != docId {
+			t.Errorf("document %s has the id %q", docId, doc.DocumentId)
+		}
+		if doc.Metadata.Status != status {
+			t.Errorf("document %s has the status %q, expected %q", docId, doc.Metadata.Status, status)
+		}
+		if doc.Timestamp == 0 || len(doc.Progress) == 0 || len(doc.DeviceId) == 0 {
+			t.Errorf("progress of document %s was lost", docId)
+		}
+	}
+}
+
+// Reverting only removes the fields of the reverted migrations, data of older schemas is kept
+func TestRevertingKeepsOlderData(t *testing.T) {
+	const docId = "0123456789abcdef0123456789abcdef"
+
+	t.Run("migration 6 keeps the document id", func(t *testing.T) {
+		db := loadMigrationFixture(t, 6)
+		doc := db.Users["alice"].Documents[docId]
+		doc.PrettyName = "Dune"
+		db.Users["alice"].Documents[docId] = doc
+
+		if err := MigrateDatabase(&db, 5, nil); err != nil {
+			t.Fatal(err)
+		}
+		doc = db.Users["alice"].Documents[docId]
+		if doc.PrettyName != "" || doc.DocumentId != docId || doc.Percentage != 0.25 {
+			t.Errorf("document is %+v", doc)
+		}
+	})
+
+	t.Run("migration 4 keeps the progress", func(t *testing.T) {
+		db := loadMigrationFixture(t, 4)
+		if err := MigrateDatabase(&db, 3, nil); err != nil {
+			t.Fatal(err)
+		}
+		doc := db.Users["alice"].Documents[docId]
+		if doc.DocumentId != "" || doc.Percentage != 0.25 || doc.Timestamp != 1700000000 {
+			t.Errorf("document is %+v", doc)
+		}
+	})
+
+	t.Run("migration 1 keeps the documents", func(t *testing.T) {
+		db := loadMigrationFixture(t, 1)
+		db.Users["alice"].History[docId] = HistoryData{DocumentHistory: []FileData{db.Users["alice"].Documents[docId]}}
+
+		if err := MigrateDatabase(&db, 0, nil); err != nil {
+			t.Fatal(err)
+		}
+		alice := db.Users["alice"]
+		if alice.History != nil || len(alice.Documents) != 2 || alice.Password != "5f4dcc3b5aa765d61d8327deb882cf99" {
+			t.Errorf("user is %+v", alice)
+		}
+	})
+
+	t.Run("migration 16 keeps users of tenants under their key", func(t *testing.T) {
+		db := loadMigrationFixture(t, 16)
+		db.Config.Tenants = append(db.Config.Tenants, TenantData{Id: "family", PathPrefix: "/family"})
+		db.Users[UserKey("family", "carol")] = UserData{Username: "carol", Tenant: "family", Password: "<password>"}
+
+		if err := MigrateDatabase(&db, 15, nil); err != nil {
+			t.Fatal(err)
+		}
+		if db.Config.Tenants != nil {
+			t.Errorf("tenants are %v", db.Config.Tenants)
+		}
+		carol, found := db.Users["family/carol"]
+		if !found || carol.Username != "family/carol" || carol.Tenant != "" || carol.Password != "<password>" {
+			t.Errorf("user of the tenant is %+v", carol)
+		}
+		if alice := db.Users["alice"]; alice.Username != "alice" {
+			t.Errorf("user outside of tenants is %+v", alice)
+		}
+	})
+}
+
+func TestNewDatabaseStartsOnTheLatestSchema(t *testing.T) {
+	t.Chdir(t.TempDir())
+	dbFile, db, err := LoadOrInitDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Schema != SchemaVersion || db.Config.Limits != DefaultLimits {
+		t.Errorf("new database has schema %d and limits %+v", db.Schema, db.Config.Limits)
+	}
+
+	_, loaded, err := LoadOrInitDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameDatabase(t, loaded, db, "database loaded from "+dbFile)
+}
+
+func TestMigrateRejectsUnknownSchemas(t *testing.T) {
+	db := loadMigrationFixture(t, SchemaVersion)
+	if err := MigrateDatabase(&db, SchemaVersion+1, nil); err == nil {
+		t.Error("migrating to an unknown schema succeeded")
+	}
+
+	db.Schema = SchemaVersion + 1
+	if err := MigrateDatabase(&db, SchemaVersion, nil); err == nil {
+		t.Error("migrating a database of a newer schema succeeded")
+	}
+}
@@ -6,6 +6,15 @@
 
 package kosync
 
+const (
+	DocumentStatusReading   = "reading"
+	DocumentStatusFinished  = "finished"
+	DocumentStatusAbandoned = "abandoned"
+
+	// FinishedPercentage is the percentage from which on a document counts as finished
+	FinishedPercentage = 0.99
+)
+
 type Database struct {
 	Schema int                 `json:"schema"`
 	Config ConfigData          `json:"config"`
@@ -13,20 +22,104 @@ type Database struct {
 }
 
 type ConfigData struct {
-	ListenAddress       string `json:"listen_address"`
-	DisableRegistration bool   `json:"disable_registration"`
-	DebugLog            bool   `json:"enable_debug_log"`
-	StoreHistory        bool   `json:"store_history"`
-	BackupEncodingType  string `json:"backup_encoding_type"`
-	BackupOnStartup     bool   `json:"backup_on_startup"`
-	WebUi               bool   `json:"enable_webui"`
+	ListenAddress       string              `json:"listen_address"`
+	DisableRegistration bool                `json:"disable_registration"`
+	DebugLog            bool                `json:"enable_debug_log"`
+	StoreHistory        bool                `json:"store_history"`
+	BackupEncodingType  string              `json:"backup_encoding_type"`
+	BackupOnStartup     bool                `json:"backup_on_startup"`
+	WebUi               bool                `json:"enable_webui"`
+	Webhooks            []WebhookData       `json:"webhooks"`
+	Metrics             bool                `json:"enable_metrics"`
+	MetricsAddress      string              `json:"metrics_listen_address"` // Serves /metrics on a separate address, empty uses the listen_address
+	LogFormat           string              `json:"log_format"`             // One of LogFormatText or LogFormatJson
+	LogLevel            string              `json:"log_level"`
+	LogLevels           map[string]string   `json:"log_levels"`         // Log level per module, overrides log_level
+	BackupSchedule      string              `json:"backup_schedule"`    // Duration or cron expression, empty disables scheduled backups
+	BackupRetention     BackupRetentionData `json:"backup_retention"`   // Rules for deleting old backups, all zero keeps every backup
+	BackupDirectory     string              `json:"backup_directory"`   // Empty uses the directory of the database file
+	BackupCompression   string              `json:"backup_compression"` // One of BackupCompressionGzip or BackupCompressionZstd, empty disables compression
+	BackupEncryption    string              `json:"backup_encryption"`  // BackupEncryptionAes or empty to disable encryption
+	BackupKeyFile       string              `json:"backup_key_file"`    // File containing the passphrase for backup encryption
+	BackupRemote        BackupRemoteData    `json:"backup_remote"`      // Offsite copy of every backup, an empty type disables uploads
+	Tenants             []TenantData        `json:"tenants"`            // Organizations with their own users, selected by hostname or path prefix
+	Limits              LimitsData          `json:"limits"`             // Protects the database from clients that store too much data
+	Tls                 TlsData             `json:"tls"`                // Serves HTTPS on the listen_address, empty serves plain HTTP
+}
+
+type TlsData struct {
+	CertFile string   `json:"cert_file"` // PEM certificate chain, reloaded when the file changes
+	KeyFile  string   `json:"key_file"`  // PEM private key of the certificate
+	Acme     AcmeData `json:"acme"`      // Obtains certificates automatically, used instead of cert_file and key_file
+}
+
+type AcmeData struct {
+	Domains           []string `json:"domains"`             // Certificates are only requested for these domains, empty disables ACME
+	Email             string   `json:"email"`               // Contact of the ACME account, optional
+	DirectoryUrl      string   `json:"directory_url"`       // Empty uses Let's Encrypt
+	CaFile            string   `json:"ca_file"`             // PEM CA certificates the ACME server is trusted with, empty uses the system CAs
+	CacheDirectory    string   `json:"cache_directory"`     // Account key and certificates, relative paths are relative to the database file
+	HttpListenAddress string   `json:"http_listen_address"` // Answers HTTP-01 challenges and redirects to HTTPS, empty uses TLS-ALPN-01 only
+}
+
+type LimitsData struct {
+	MaxDocuments      int `json:"max_documents"`       // Per user, 0 is unlimited
+	MaxHistoryEntries int `json:"max_history_entries"` // Per document, the oldest entries are dropped, 0 is unlimited
+	MaxBodySize       int `json:"max_body_size"`       // Bytes of progress pushes and document updates, 0 is unlimited
+	MaxFieldLength    int `json:"max_field_length"`    // Characters of progress, device, device_id and pretty_name, 0 is unlimited
+}
+
+type TenantData struct {
+	Id                  string          `json:"id"` // Prefix of the user keys, must not contain a "/"
+	Name                string          `json:"name"`
+	Hostnames           []string        `json:"hostnames"`   // Requests for these hostnames belong to the tenant
+	PathPrefix          string          `json:"path_prefix"` // Requests below this path like /family belong to the tenant
+	DisableRegistration bool            `json:"disable_registration"`
+	Quotas              TenantQuotaData `json:"quotas"`
+}
+
+type TenantQuotaData struct {
+	MaxUsers     int `json:"max_users"`     // 0 is unlimited
+	MaxDocuments int `json:"max_documents"` // Per user, 0 is unlimited
+}
+
+type BackupRemoteData struct {
+	Type      string `json:"type"`       // One of BackupRemoteS3 or BackupRemoteWebdav
+	Url       string `json:"url"`        // Endpoint of the S3 service or URL of the WebDAV collection
+	Bucket    string `json:"bucket"`     // S3 only
+	Region    string `json:"region"`     // S3 only, defaults to us-east-1
+	Prefix    string `json:"prefix"`     // Prepended to the backup file names
+	AccessKey string `json:"access_key"` // S3 only
+	SecretKey string `json:"secret_key"` // S3 only
+	Username  string `json:"username"`   // WebDAV only, empty disables basic auth
+	Password  string `json:"password"`   // WebDAV only
+}
+
+type BackupRetentionData struct {
+	KeepLast    int `json:"keep_last"`
+	KeepDaily   int `json:"keep_daily"`
+	KeepWeekly  int `json:"keep_weekly"`
+	KeepMonthly int `json:"keep_monthly"`
 }
 
 type UserData struct {
-	Username  string                 `json:"username"`
-	Password  string                 `json:"password"`
-	Documents map[string]FileData    `json:"documents"`
-	History   map[string]HistoryData `json:"history"`
+	Username      string                 `json:"username"`
+	Password      string                 `json:"password"`
+	Documents     map[string]FileData    `json:"documents"`
+	History       map[string]HistoryData `json:"history"`
+	Aliases       map[string]string      `json:"aliases"` // Maps merged document ids to their canonical document id
+	Webhooks      []WebhookData          `json:"webhooks"`
+	IsAdmin       bool                   `json:"is_admin"`
+	Tenant        string                 `json:"tenant"`          // Id of the tenant, empty for users outside of tenants
+	IsTenantAdmin bool                   `json:"is_tenant_admin"` // Manages the users of its tenant, never set for users outside of tenants
+}
+
+// ResolveDocumentId returns the canonical document id for a merged document id, other ids are returned unchanged
+func (user UserData) ResolveDocumentId(documentId string) string {
+	if canonical, found := user.Aliases[documentId]; found {
+		return canonical
+	}
+	return documentId
 }
 
 type ProgressData struct {
@@ -43,9 +136,26 @@ type DocumentData struct {
 
 type FileData struct {
 	ProgressData
-	DocumentId string `json:"document"`
-	Timestamp  int64  `json:"timestamp"`
-	PrettyName string `json:"pretty_name"` // User given name of Document, set via WebUI
+	DocumentId string           `json:"document"`
+	Timestamp  int64            `json:"timestamp"`
+	PrettyName string           `json:"pretty_name"` // User given name of Document, set via WebUI
+	Metadata   DocumentMetadata `json:"metadata"`
+}
+
+type DocumentMetadata struct {
+	Title    string   `json:"title"`
+	Authors  []string `json:"authors"`
+	Series   string   `json:"series"`
+	Tags     []string `json:"tags"`
+	Notes    string   `json:"notes"`
+	CoverUrl string   `json:"cover_url"`
+	Status   string   `json:"status"` // One of DocumentStatusReading, DocumentStatusFinished or DocumentStatusAbandoned
+}
+
+type WebhookData struct {
+	Url    string   `json:"url"`
+	Secret string   `json:"secret"` // Key for the HMAC-SHA256 signature of the payload
+	Events []string `json:"events"` // Subscribed events, an empty list subscribes to all events
 }
 
 type HistoryData struct {
@@ -0,0 +1,274 @@
+//
+// File:        internal/kosync/database_restore.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	RestoreChangeAdded   = "added"
+	RestoreChangeRemoved = "removed"
+	RestoreChangeUpdated = "updated"
+)
+
+// RestoreOptions select what is restored from a backup, without users and documents the whole database is replaced
+type RestoreOptions struct {
+	Users     []string // Users that are restored, with Documents only these documents of the users
+	Documents []string // Documents that are restored, without Users for every user that has them in the backup
+	DryRun    bool     // Only report the changes
+}
+
+// Partial reports whether only a part of the database is restored
+func (o RestoreOptions) Partial() bool {
+	return len(o.Users) > 0 || len(o.Documents) > 0
+}
+
+type RestoreChangeData struct {
+	Username string `json:"username"`
+	Document string `json:"document,omitempty"`
+	Change   string `json:"change"` // One of RestoreChangeAdded, RestoreChangeRemoved or RestoreChangeUpdated
+	Details  string `json:"details,omitempty"`
+}
+
+// RestoreFromCommandLine restores a part of a backup into the loaded database and prints the changes
+func (app *Kosync) RestoreFromCommandLine(reference string, options RestoreOptions) error {
+	app.Logger("Restore").Info("Trying to restore from backup", "file", reference, "users", options.Users, "documents", options.Documents, "dry_run", options.DryRun)
+	backupData, err := ReadBackup(reference, app.Db.Config)
+	if err != nil {
+		return err
+	}
+
+	changes, err := app.RestoreBackupData(backupData, options)
+	if err != nil {
+		return err
+	}
+	if options.DryRun {
+		fmt.Printf("Restoring '%s' would make %d changes:\n", reference, len(changes))
+	} else {
+		fmt.Printf("Restored '%s' with %d changes:\n", reference, len(changes))
+		app.Audit(nil, AuditDatabaseRestored, "", restoreAuditDetails(reference, options))
+		app.AuditRestoredDeletions(nil, changes)
+	}
+	for _, change := range changes {
+		fmt.Println(change.String())
+	}
+	return nil
+}
+
+// RestoreDryRun migrates the loaded database in memory and prints the changes a restore would make, the database file is not changed
+func (app *Kosync) RestoreDryRun(reference string, options RestoreOptions) error {
+	if err := MigrateDatabase(&app.Db, SchemaVersion, nil); err != nil {
+		return err
+	}
+	options.DryRun = true
+	return app.RestoreFromCommandLine(reference, options)
+}
+
+// AuditRestoredDeletions records the documents a restore removed from users that still exist
+func (app *Kosync) AuditRestoredDeletions(c *fiber.Ctx, changes []RestoreChangeData) {
+	for _, change := range changes {
+		if change.Change == RestoreChangeRemoved && len(change.Document) > 0 {
+			app.Audit(c, AuditDocumentDeleted, change.Username, map[string]string{"document": change.Document, "reason": "restore"})
+		}
+	}
+}
+
+// restoreAuditDetails describes a restore for the audit log
+func restoreAuditDetails(file string, options RestoreOptions) map[string]string {
+	details := map[string]string{"file": file}
+	if len(options.Users) > 0 {
+		details["users"] = strings.Join(options.Users, ",")
+	}
+	if len(options.Documents) > 0 {
+		details["documents"] = strings.Join(options.Documents, ",")
+	}
+	return details
+}
+
+func (c RestoreChangeData) String() string {
+	symbol := map[string]string{RestoreChangeAdded: "+", RestoreChangeRemoved: "-", RestoreChangeUpdated: "~"}[c.Change]
+	target := fmt.Sprintf("user '%s'", c.Username)
+	if len(c.Document) > 0 {
+		target += fmt.Sprintf(" document '%s'", c.Document)
+	}
+	if len(c.Details) > 0 {
+		return fmt.Sprintf("%s %s: %s", symbol, target, c.Details)
+	}
+	return fmt.Sprintf("%s %s", symbol, target)
+}
+
+// SelectiveRestore returns a copy of the live database with the selected users or documents taken from the backup.
+// Both databases must have the current schema, the live database is not modified.
+func SelectiveRestore(live, backup Database, options RestoreOptions) (Database, error) {
+	result := live
+	result.Users = maps.Clone(live.Users)
+
+	if len(options.Documents) == 0 {
+		for _, username := range options.Users {
+			user, found := backup.Users[username]
+			if !found {
+				return Database{}, fmt.Errorf("user '%s' does not exist in the backup", username)
+			}
+			result.Users[username] = user
+		}
+		return result, nil
+	}
+
+	usernames := options.Users
+	if len(usernames) == 0 {
+		for username, user := range backup.Users {
+			for _, documentId := range options.Documents {
+				if _, found := user.Documents[user.ResolveDocumentId(documentId)]; found {
+					usernames = append(usernames, username)
+					break
+				}
+			}
+		}
+		if len(usernames) == 0 {
+			return Database{}, fmt.Errorf("none of the documents exist in the backup")
+		}
+	}
+
+	for _, username := range usernames {
+		backupUser, found := backup.Users[username]
+		if !found {
+			return Database{}, fmt.Errorf("user '%s' does not exist in the backup", username)
+		}
+		user, found := result.Users[username]
+		if !found {
+			return Database{}, fmt.Errorf("user '%s' does not exist, restore the whole user instead", username)
+		}
+
+		// Copy the maps, they are shared with the live database
+		user.Documents = maps.Clone(user.Documents)
+		user.History = maps.Clone(user.History)
+		if user.History == nil {
+			user.History = make(map[string]HistoryData)
+		}
+		user.Aliases = maps.Clone(user.Aliases)
+		if user.Aliases == nil {
+			user.Aliases = make(map[string]string)
+		}
+		for _, documentId := range options.Documents {
+			// Merged documents are restored with their canonical document and all of its aliases
+			documentId = backupUser.ResolveDocumentId(documentId)
+			document, found := backupUser.Documents[documentId]
+			if !found {
+				continue
+			}
+			user.Documents[documentId] = document
+			if history, found := backupUser.History[documentId]; found {
+				user.History[documentId] = history
+			} else {
+				delete(user.History, documentId)
+			}
+			// A live alias of the id would hide the restored document, live documents are never hidden by a restored alias
+			delete(user.Aliases, documentId)
+			for alias, canonical := range backupUser.Aliases {
+				if _, isDocument := user.Documents[alias]; canonical == documentId && !isDocument {
+					user.Aliases[alias] = documentId
+				}
+			}
+		}
+		result.Users[username] = user
+	}
+	return result, nil
+}
+
+// DiffDatabases lists the changes of users and documents between two databases, sorted by user and document
+func DiffDatabases(before, after Database) []RestoreChangeData {
+	changes := make([]RestoreChangeData, 0)
+
+	usernames := make([]string, 0, len(before.Users)+len(after.Users))
+	for username := range before.Users {
+		usernames = append(usernames, username)
+	}
+	for username := range after.Users {
+		if _, found := before.Users[username]; !found {
+			usernames = append(usernames, username)
+		}
+	}
+	sort.Strings(usernames)
+	for _, username := range usernames {
+		beforeUser, inBefore := before.Users[username]
+		afterUser, inAfter := after.Users[username]
+		if !inBefore {
+			changes = append(changes, RestoreChangeData{Username: username, Change: RestoreChangeAdded, Details: fmt.Sprintf("%d documents", len(afterUser.Documents))})
+			continue
+		}
+		if !inAfter {
+			changes = append(changes, RestoreChangeData{Username: username, Change: RestoreChangeRemoved, Details: fmt.Sprintf("%d documents", len(beforeUser.Documents))})
+			continue
+		}
+
+		fields := make([]string, 0)
+		if beforeUser.Password != afterUser.Password {
+			fields = append(fields, "password")
+		}
+		if beforeUser.IsAdmin != afterUser.IsAdmin {
+			fields = append(fields, "is_admin")
+		}
+		if beforeUser.IsTenantAdmin != afterUser.IsTenantAdmin {
+			fields = append(fields, "is_tenant_admin")
+		}
+		if !reflect.DeepEqual(beforeUser.Aliases, afterUser.Aliases) {
+			fields = append(fields, "aliases")
+		}
+		if !reflect.DeepEqual(beforeUser.Webhooks, afterUser.Webhooks) {
+			fields = append(fields, "webhooks")
+		}
+		if len(fields) > 0 {
+			changes = append(changes, RestoreChangeData{Username: username, Change: RestoreChangeUpdated, Details: strings.Join(fields, ", ")})
+		}
+		changes = append(changes, diffDocuments(username, beforeUser, afterUser)...)
+	}
+	return changes
+}
+
+func diffDocuments(username string, before, after UserData) []RestoreChangeData {
+	changes := make([]RestoreChangeData, 0)
+	documentIds := make([]string, 0, len(before.Documents)+len(after.Documents))
+	for documentId := range before.Documents {
+		documentIds = append(documentIds, documentId)
+	}
+	for documentId := range after.Documents {
+		if _, found := before.Documents[documentId]; !found {
+			documentIds = append(documentIds, documentId)
+		}
+	}
+	sort.Strings(documentIds)
+
+	for _, documentId := range documentIds {
+		beforeDoc, inBefore := before.Documents[documentId]
+		afterDoc, inAfter := after.Documents[documentId]
+		change := RestoreChangeData{Username: username, Document: documentId}
+		switch {
+		case !inBefore:
+			change.Change = RestoreChangeAdded
+			change.Details = fmt.Sprintf("%.1f%%", afterDoc.Percentage*100)
+		case !inAfter:
+			change.Change = RestoreChangeRemoved
+			change.Details = fmt.Sprintf("%.1f%%", beforeDoc.Percentage*100)
+		case beforeDoc.Percentage != afterDoc.Percentage:
+			change.Change = RestoreChangeUpdated
+			change.Details = fmt.Sprintf("%.1f%% -> %.1f%%", beforeDoc.Percentage*100, afterDoc.Percentage*100)
+		case !reflect.DeepEqual(beforeDoc, afterDoc) || !reflect.DeepEqual(before.History[documentId], after.History[documentId]):
+			change.Change = RestoreChangeUpdated
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
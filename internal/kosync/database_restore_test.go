@@ -0,0 +1,160 @@
+//
+// File:        internal/kosync/database_restore_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"encoding/pem"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// testBackup encodes the database as an unencrypted backup file
+func testBackup(t *testing.T, db Database) []byte {
+	t.Helper()
+	block, err := EncodeBackup(db, "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(block)
+}
+
+// TestRestoreWhileServing swaps the database while requests read it, run with -race to find unlocked reads
+func TestRestoreWhileServing(t *testing.T) {
+	app := newTestApp(t)
+	addTestUser(app, "", "alice")
+	backup := testBackup(t, app.Db)
+
+	fiberApp := fiber.New()
+	fiberApp.Use(app.NewAuthMiddleware())
+	fiberApp.Get("/syncs/progress/:document", app.SyncsGetProgress)
+	fiberApp.Get("/api/documents.all", app.ApiGetDocumentsAll)
+	fiberApp.Get("/api/webhooks.all", app.ApiGetWebhooks)
+	fiberApp.Get("/api/audit.query", app.RequireAdmin, app.ApiGetAudit)
+
+	var wg sync.WaitGroup
+	for _, path := range []string{"/syncs/progress/0123456789abcdef0123456789abcdef", "/api/documents.all", "/api/webhooks.all", "/api/audit.query"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				req := httptest.NewRequest(fiber.MethodGet, path, nil)
+				req.Header.Set("x-auth-user", "alice")
+				req.Header.Set("x-auth-key", testUserKey)
+				resp, err := fiberApp.Test(req, -1)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				_ = resp.Body.Close()
+			}
+		}()
+	}
+	for range 5 {
+		if _, err := app.RestoreBackupData(backup, RestoreOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestRestoreAppliesTheConfig(t *testing.T) {
+	app := newTestApp(t)
+	if err := app.ConfigureLogging(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Config.LogLevels = map[string]string{"Syncs": "error"}
+	if _, err := app.RestoreBackupData(testBackup(t, db), RestoreOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if app.Logging.Load().moduleLevels["syncs"] != slog.LevelError {
+		t.Error("the log levels of the restored config are not used")
+	}
+
+	db.Config.Tenants = []TenantData{{Id: "family"}}
+	if _, err := app.RestoreBackupData(testBackup(t, db), RestoreOptions{}); err == nil {
+		t.Error("a backup with an invalid tenant was restored")
+	}
+	if len(app.Db.Config.Tenants) > 0 {
+		t.Error("the database was replaced by a backup with an invalid tenant")
+	}
+}
+
+func TestRestoreDryRunKeepsTheDatabaseFile(t *testing.T) {
+	app := newTestApp(t)
+	addTestUser(app, "", "alice")
+	backupFile := filepath.Join(t.TempDir(), BackupFileName(time.Now()))
+	if err := os.WriteFile(backupFile, testBackup(t, app.Db), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The database file is one schema behind, the dry run must not migrate it
+	app.Db.Schema = SchemaVersion - 1
+	app.Db.Config.Tls = TlsData{}
+	addTestUser(app, "", "bob")
+	if err := app.PersistDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(app.DbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.RestoreDryRun(backupFile, RestoreOptions{Users: []string{"alice"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := os.ReadFile(app.DbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Error("the dry run changed the database file")
+	}
+	if backups, _ := ListBackups(app.BackupDirectory()); len(backups) > 0 {
+		t.Errorf("the dry run created backups %v", backups)
+	}
+}
+
+func TestSelectiveRestoreKeepsMergedDocumentsReachable(t *testing.T) {
+	const canonical, alias = "0123456789abcdef0123456789abcdef", "fedcba9876543210fedcba9876543210"
+	document := FileData{ProgressData: ProgressData{Percentage: 0.5, Progress: "p", Device: "d"}, DocumentId: canonical, Timestamp: 100}
+	backup := newTestApp(t)
+	addTestUser(backup, "", "alice")
+	backup.Db.Users["alice"].Documents[canonical] = document
+	backup.Db.Users["alice"].Aliases[alias] = canonical
+
+	live := newTestApp(t)
+	addTestUser(live, "", "alice")
+	// Live the ids were merged the other way around, which would hide the restored document
+	live.Db.Users["alice"].Aliases[canonical] = alias
+
+	for _, documentId := range []string{canonical, alias} {
+		restored, err := SelectiveRestore(live.Db, backup.Db, RestoreOptions{Documents: []string{documentId}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		user := restored.Users["alice"]
+		for _, id := range []string{canonical, alias} {
+			if found, ok := user.Documents[user.ResolveDocumentId(id)]; !ok || found.Timestamp != document.Timestamp {
+				t.Errorf("restoring %s: document %s resolves to %+v", documentId, id, found)
+			}
+		}
+		if _, found := live.Db.Users["alice"].Aliases[alias]; found {
+			t.Error("the live database was changed")
+		}
+	}
+}
@@ -0,0 +1,86 @@
+//
+// File:        internal/kosync/events.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import "sync"
+
+const (
+	EventDocumentProgress = "document.progress"
+	EventDocumentUpdated  = "document.updated"
+	EventDocumentMerged   = "document.merged"
+	EventDocumentUnmerged = "document.unmerged"
+
+	// eventBufferSize is the number of events a slow subscriber can lag behind before events are dropped
+	eventBufferSize = 16
+)
+
+type Event struct {
+	Type      string   `json:"type"`
+	Timestamp int64    `json:"timestamp"`
+	Document  FileData `json:"document"`
+}
+
+// EventBroker distributes events of a user to all of their subscribers, the zero value is ready to use
+type EventBroker struct {
+	lock        sync.Mutex
+	subscribers map[string]map[chan Event]struct{}
+}
+
+func (broker *EventBroker) Subscribe(username string) chan Event {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+
+	if broker.subscribers == nil {
+		broker.subscribers = make(map[string]map[chan Event]struct{})
+	}
+	if broker.subscribers[username] == nil {
+		broker.subscribers[username] = make(map[chan Event]struct{})
+	}
+
+	events := make(chan Event, eventBufferSize)
+	broker.subscribers[username][events] = struct{}{}
+	return events
+}
+
+// Unsubscribe removes and closes the channel, it is safe to call multiple times
+func (broker *EventBroker) Unsubscribe(username string, events chan Event) {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+
+	if _, found := broker.subscribers[username][events]; !found {
+		return
+	}
+	delete(broker.subscribers[username], events)
+	if len(broker.subscribers[username]) == 0 {
+		delete(broker.subscribers, username)
+	}
+	close(events)
+}
+
+// Close closes all subscriptions of the user, which ends their event streams
+func (broker *EventBroker) Close(username string) {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+
+	for events := range broker.subscribers[username] {
+		close(events)
+	}
+	delete(broker.subscribers, username)
+}
+
+// Publish sends the event to all subscribers of the user without blocking, full subscribers miss the event
+func (broker *EventBroker) Publish(username string, event Event) {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+
+	for events := range broker.subscribers[username] {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
@@ -7,57 +7,81 @@
 package kosync
 
 import (
-	// bearer:disable go_gosec_blocklist_md5
-	"crypto/md5"
 	"flag"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"git.obth.eu/atjontv/kosync/internal/webui"
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/gofiber/fiber/v2/middleware/basicauth"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/filesystem"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/requestid"
 )
 
 const Version = "2026.04.1"
 
 type Kosync struct {
-	Db     Database
-	DbLock sync.Mutex
-	DbFile string
+	Db               Database
+	DbLock           sync.Mutex
+	DbFile           string
+	StatsCache       map[string]StatsData
+	StatsGeneration  uint64 // Incremented by every invalidation, statistics computed before are not cached
+	StatsLock        sync.Mutex
+	Events           EventBroker
+	WebhookLock      sync.Mutex
+	LastPersistError atomic.Value            // Message of the last failed persist, empty after a successful one
+	Logging          atomic.Pointer[Logging] // Replaced when a restore changes the log config
+	AuditLock        sync.Mutex
 }
 
-func (app *Kosync) PrintDebug(marker, requestId, s string) {
-	// Only print debugs when enabled
-	if app.Db.Config.DebugLog {
-		log.Debugf("RequestId=%s, Module=%s: %s\n", requestId, marker, s)
+func Run() {
+	// Subcommands like "kosync healthcheck" run instead of the server
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(RunCommand(os.Args[1], os.Args[2:]))
 	}
-}
-
-func (app *Kosync) Print(marker, requestId, s string) {
-	log.Infof("RequestId=%s, Module=%s: %s\n", requestId, marker, s)
-}
 
-func (app *Kosync) PrintError(marker, requestId, s string) {
-	log.Errorf("RequestId=%s, Module=%s: %s\n", requestId, marker, s)
-}
-
-func Run() {
-	log.Infof("KOsync Server v%s by Thomas Obernosterer (https://obth.eu)", Version)
-	log.Info("Copyright 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later.")
-	log.Info("Obtain the Source Code at https://git.obth.eu/atjontv/kosync")
+	slog.Info(fmt.Sprintf("KOsync Server v%s by Thomas Obernosterer (https://obth.eu)", Version))
+	slog.Info("Copyright 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later.")
+	slog.Info("Obtain the Source Code at https://git.obth.eu/atjontv/kosync")
 
 	restoreFile := flag.String("restore", "", "Specify a .bak file to restore")
+	restoreUsers := flag.String("restore-users", "", "Comma separated users to restore from the --restore file, other users are kept")
+	restoreDocuments := flag.String("restore-documents", "", "Comma separated documents to restore from the --restore file, other documents are kept")
+	restoreDryRun := flag.Bool("restore-dry-run", false, "Print the changes of --restore and exit without changing the database")
+	migrateDryRun := flag.Bool("migrate-dry-run", false, "Print the changes of pending migrations and exit without changing the database")
 	makeBackup := flag.Bool("backup", false, "Create a .bak file before startup")
 	enableWeb := flag.Bool("webui", false, "Enable the web interface at /web")
 	flag.Parse()
 
-	if restoreFile != nil && len(*restoreFile) > 0 {
+	if *migrateDryRun {
+		os.Exit(CommandMigrate([]string{"up", "--dry-run"}))
+	}
+
+	// Partial restores need the migrated live database, they happen after the migrations.
+	// Dry runs migrate the database in memory only and exit before anything is written.
+	restoreOptions := RestoreOptions{
+		Users:     normalizeList(strings.Split(*restoreUsers, ",")),
+		Documents: normalizeList(strings.Split(*restoreDocuments, ",")),
+		DryRun:    *restoreDryRun,
+	}
+	if len(*restoreFile) > 0 && restoreOptions.DryRun {
+		koapp, err := loadCommandDatabase()
+		if err != nil {
+			panic(err)
+		}
+		if err := koapp.RestoreDryRun(*restoreFile, restoreOptions); err != nil {
+			panic(err)
+		}
+		return
+	}
+	fullRestore := len(*restoreFile) > 0 && !restoreOptions.Partial()
+	if fullRestore {
 		if err := RestoreDatabase(*restoreFile); err != nil {
 			panic(err)
 		}
@@ -78,6 +102,13 @@ func Run() {
 		_ = koapp.PersistDatabase()
 	}(&koapp)
 
+	if err := koapp.ConfigureLogging(); err != nil {
+		panic(err)
+	}
+	if fullRestore {
+		koapp.Audit(nil, AuditDatabaseRestored, "", map[string]string{"file": *restoreFile})
+	}
+
 	if err := koapp.MigrateSchema(); err != nil {
 		panic(err)
 	}
@@ -87,15 +118,38 @@ func Run() {
 		panic(err)
 	}
 
+	if len(*restoreFile) > 0 && !fullRestore {
+		if err := koapp.RestoreFromCommandLine(*restoreFile, restoreOptions); err != nil {
+			panic(err)
+		}
+	}
+
 	if koapp.Db.Config.BackupOnStartup || (makeBackup != nil && *makeBackup) {
-		if err := koapp.BackupDatabase(); err != nil {
-			koapp.PrintError("Backup", "-", fmt.Sprintf("Failed to create backup, continuing startup: %v", err))
+		if _, err := koapp.BackupDatabase(); err != nil {
+			koapp.Logger("Backup").Error("Failed to create backup, continuing startup", "error", err)
 		}
 	}
 
+	if err := ValidateTenants(koapp.Db.Config.Tenants); err != nil {
+		panic(err)
+	}
+	if err := ValidateTls(koapp.Db.Config.Tls); err != nil {
+		panic(err)
+	}
+
+	if len(koapp.Db.Config.BackupSchedule) > 0 {
+		schedule, err := ParseBackupSchedule(koapp.Db.Config.BackupSchedule)
+		if err != nil {
+			panic(err)
+		}
+		go koapp.RunBackupSchedule(schedule)
+	}
+
 	app := fiber.New(fiber.Config{
 		AppName:      fmt.Sprintf("KOsync v%s", Version),
 		ServerHeader: "KOsync (https://git.obth.eu/atjontv/kosync)",
+		// The banner would break parsers of JSON logs
+		DisableStartupMessage: koapp.Db.Config.LogFormat == LogFormatJson,
 	})
 	defer func(app *fiber.App) {
 		err := app.Shutdown()
@@ -104,32 +158,48 @@ func Run() {
 		}
 	}(app)
 	app.Use(requestid.New())
-	app.Use(logger.New(logger.Config{
-		Format: "${time} | ${locals:requestid} | ${status} | ${latency} | ${ip} | ${method} | ${path} | ${error}\n",
-	}))
+	if koapp.Db.Config.Metrics {
+		app.Use(koapp.NewMetricsMiddleware())
+		if len(koapp.Db.Config.MetricsAddress) == 0 {
+			app.Get("/metrics", koapp.MetricsHandler)
+		} else {
+			go koapp.ListenMetrics(koapp.Db.Config.MetricsAddress)
+		}
+	}
+	app.Use(koapp.NewAccessLogMiddleware())
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
 	}))
+	app.Use(koapp.NewTenantMiddleware())
 	app.Use(koapp.NewAuthMiddleware())
 
 	if koapp.Db.Config.WebUi || (enableWeb != nil && *enableWeb) {
-		app.Use("/api/auth.basic", basicauth.New(basicauth.Config{
-			Realm: "KOsync",
-			Authorizer: func(user string, pass string) bool {
-				// NOTE: Must be MD5 because that is what the KOReader Plugin is hardcoded to use
-				// bearer:disable go_gosec_crypto_weak_crypto
-				// bearer:disable go_lang_weak_hash_md5
-				pwHash := fmt.Sprintf("%x", md5.Sum([]byte(pass)))
-
-				userData, found := koapp.Db.Users[user]
-				if !found {
-					return false
-				}
-
-				return userData.Password == pwHash
-			},
-			ContextUsername: "current_user",
-		}))
+		app.Use("/api/auth.basic", func(c *fiber.Ctx) error {
+			// The Authorizer has no access to the request, so it is created for the tenant of the request
+			tenant := CurrentTenant(c)
+			return basicauth.New(basicauth.Config{
+				Realm: "KOsync",
+				Authorizer: func(user string, pass string) bool {
+					koapp.LockDb()
+					userData, found := koapp.Db.Users[UserKey(tenant, user)]
+					koapp.DbLock.Unlock()
+					if !found || userData.Tenant != tenant {
+						return false
+					}
+
+					return userData.Password == PasswordKey(pass)
+				},
+				Unauthorized: func(c *fiber.Ctx) error {
+					// Browsers first ask without credentials, only requests with credentials are failed logins
+					if len(c.Get(fiber.HeaderAuthorization)) > 0 {
+						koapp.Audit(c, AuditLoginFailed, "", map[string]string{"method": "basic"})
+					}
+					c.Set(fiber.HeaderWWWAuthenticate, `basic realm="KOsync"`)
+					return c.SendStatus(fiber.StatusUnauthorized)
+				},
+				ContextUsername: "current_user",
+			})(c)
+		})
 
 		app.Use("/web", filesystem.New(filesystem.Config{
 			Root:       http.FS(webui.WebUi),
@@ -137,7 +207,7 @@ func Run() {
 		}))
 
 		app.Get("/", func(c *fiber.Ctx) error {
-			return c.Redirect("/web")
+			return c.Redirect(TenantPathPrefix(c) + "/web")
 		})
 	} else {
 		app.Get("/", func(c *fiber.Ctx) error {
@@ -145,6 +215,9 @@ func Run() {
 		})
 	}
 
+	app.Get("/healthz", koapp.ApiGetHealth)
+	app.Get("/readyz", koapp.ApiGetReady)
+
 	app.Get("/users/auth", koapp.UsersAuth)
 	app.Post("/users/create", koapp.UsersCreate)
 
@@ -153,9 +226,31 @@ func Run() {
 
 	app.Get("/api/documents.all", koapp.ApiGetDocumentsAll)
 	app.Put("/api/documents.update", koapp.ApiPutDocument)
+	app.Put("/api/documents.metadata", koapp.ApiPutDocumentMetadata)
+	app.Put("/api/documents.merge", koapp.ApiPutDocumentMerge)
+	app.Put("/api/documents.unmerge", koapp.ApiPutDocumentUnmerge)
 	app.Get("/api/auth.basic", koapp.ApiAuthBasic)
+	app.Get("/api/stats", koapp.ApiGetStats)
+	app.Get("/api/events", koapp.ApiGetEvents)
+	app.Get("/api/webhooks.all", koapp.ApiGetWebhooks)
+	app.Put("/api/webhooks.update", koapp.ApiPutWebhooks)
+	app.Get("/api/webhooks.deliveries", koapp.ApiGetWebhookDeliveries)
+	app.Get("/api/me", koapp.ApiGetMe)
+	app.Put("/api/me/password", koapp.ApiPutMePassword)
+	app.Put("/api/me/username", koapp.ApiPutMeUsername)
+	app.Get("/api/me/export", koapp.ApiGetMeExport)
+	app.Delete("/api/me", koapp.ApiDeleteMe)
+	app.Get("/api/tenant.users", koapp.RequireTenantAdmin, koapp.ApiGetTenantUsers)
+	app.Delete("/api/tenant.users", koapp.RequireTenantAdmin, koapp.ApiDeleteTenantUser)
+
+	app.Get("/api/audit.query", koapp.RequireAdmin, koapp.ApiGetAudit)
+	app.Post("/api/backups.create", koapp.RequireAdmin, koapp.ApiPostBackupCreate)
+	app.Get("/api/backups.list", koapp.RequireAdmin, koapp.ApiGetBackups)
+	app.Post("/api/backups.restore", koapp.RequireAdmin, koapp.ApiPostBackupRestore)
+	app.Get("/api/database.export", koapp.RequireAdmin, koapp.ApiGetDatabaseExport)
+	app.Post("/api/database.import", koapp.RequireAdmin, koapp.ApiPostDatabaseImport)
 
-	if err = app.Listen(koapp.Db.Config.ListenAddress); err != nil {
+	if err = koapp.Listen(app); err != nil {
 		panic(err)
 	}
 }
@@ -0,0 +1,38 @@
+//
+// File:        internal/kosync/kosync_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// testUserKey is the key of the password "password", which all users of the tests have
+const testUserKey = "5f4dcc3b5aa765d61d8327deb882cf99"
+
+// newTestApp returns an app with a new database, the database file is written to a temporary directory
+func newTestApp(t testing.TB) *Kosync {
+	t.Helper()
+	db, err := NewDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Kosync{Db: db, DbFile: filepath.Join(t.TempDir(), "database.json")}
+}
+
+// addTestUser adds a user without documents to the database of the app
+func addTestUser(app *Kosync, tenant, username string) {
+	app.Db.Users[UserKey(tenant, username)] = UserData{
+		Username:  username,
+		Password:  testUserKey,
+		Documents: make(map[string]FileData),
+		History:   make(map[string]HistoryData),
+		Aliases:   make(map[string]string),
+		Webhooks:  make([]WebhookData, 0),
+		Tenant:    tenant,
+	}
+}
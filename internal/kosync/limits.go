@@ -0,0 +1,81 @@
+//
+// File:        internal/kosync/limits.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"fmt"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultLimits are generous for KOReader, which sends a few hundred bytes per progress push
+var DefaultLimits = LimitsData{
+	MaxDocuments:      10000,
+	MaxHistoryEntries: 1000,
+	MaxBodySize:       16 * 1024,
+	MaxFieldLength:    1024,
+}
+
+// CheckBody rejects request bodies larger than MaxBodySize
+func (limits LimitsData) CheckBody(c *fiber.Ctx) error {
+	if limits.MaxBodySize > 0 && len(c.Body()) > limits.MaxBodySize {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds the limit of %d bytes", limits.MaxBodySize))
+	}
+	return nil
+}
+
+// CheckField rejects values with more characters than MaxFieldLength
+func (limits LimitsData) CheckField(name, value string) error {
+	if limits.MaxFieldLength > 0 && utf8.RuneCountInString(value) > limits.MaxFieldLength {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("%s exceeds the limit of %d characters", name, limits.MaxFieldLength))
+	}
+	return nil
+}
+
+// TrimHistory drops the oldest entries of a history that exceeds MaxHistoryEntries
+func (limits LimitsData) TrimHistory(history []FileData) []FileData {
+	if limits.MaxHistoryEntries > 0 && len(history) > limits.MaxHistoryEntries {
+		return slices.Clone(history[len(history)-limits.MaxHistoryEntries:])
+	}
+	return history
+}
+
+// CurrentLimits returns the limits of the config
+func (app *Kosync) CurrentLimits() LimitsData {
+	app.LockDb()
+	defer app.DbLock.Unlock()
+	return app.Db.Config.Limits
+}
+
+// DocumentLimit returns the maximum number of documents of the user, the lower of MaxDocuments and the quota of its tenant
+func (db *Database) DocumentLimit(user UserData) int {
+	limit := db.Config.Limits.MaxDocuments
+	if tenant, found := db.FindTenant(user.Tenant); found && tenant.Quotas.MaxDocuments > 0 {
+		if limit <= 0 || tenant.Quotas.MaxDocuments < limit {
+			limit = tenant.Quotas.MaxDocuments
+		}
+	}
+	return limit
+}
+
+// CheckDocumentLimit rejects documents that would exceed the document limit of the user, existing documents can always be updated.
+// Callers on the database of the server hold the DbLock until the document is stored, so parallel pushes can not exceed the limit.
+func (db *Database) CheckDocumentLimit(user UserData, documentId string) error {
+	limit := db.DocumentLimit(user)
+	if limit <= 0 {
+		return nil
+	}
+	if _, exists := user.Documents[user.ResolveDocumentId(documentId)]; exists {
+		return nil
+	}
+	if len(user.Documents) >= limit {
+		return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("the limit of %d documents is reached", limit))
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+//
+// File:        internal/kosync/logging.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJson = "json"
+)
+
+// Logging holds the handler and levels configured by ConfigureLogging, without one the default logger is used
+type Logging struct {
+	handler      slog.Handler
+	defaultLevel slog.Level
+	moduleLevels map[string]slog.Level
+}
+
+// ConfigureLogging sets up structured logging from the config and makes it the default logger
+func (app *Kosync) ConfigureLogging() error {
+	app.LockDb()
+	config := app.Db.Config
+	app.DbLock.Unlock()
+
+	logging, err := NewLogging(config)
+	if err != nil {
+		return err
+	}
+	app.UseLogging(logging)
+	return nil
+}
+
+// UseLogging replaces the logging of the server, requests that are already running keep their loggers
+func (app *Kosync) UseLogging(logging *Logging) {
+	app.Logging.Store(logging)
+	slog.SetDefault(slog.New(&levelHandler{level: logging.defaultLevel, handler: logging.handler}))
+}
+
+// NewLogging creates the handler and levels of the config
+func NewLogging(config ConfigData) (*Logging, error) {
+	defaultLevel, err := ParseLogLevel(config.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	if config.DebugLog {
+		defaultLevel = slog.LevelDebug
+	}
+
+	moduleLevels := make(map[string]slog.Level)
+	for module, levelName := range config.LogLevels {
+		level, err := ParseLogLevel(levelName)
+		if err != nil {
+			return nil, fmt.Errorf("log level of module '%s': %w", module, err)
+		}
+		moduleLevels[strings.ToLower(module)] = level
+	}
+
+	// Level filtering happens per module, so the handler itself lets everything through
+	options := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var handler slog.Handler
+	switch config.LogFormat {
+	case LogFormatJson:
+		handler = slog.NewJSONHandler(os.Stdout, options)
+	case LogFormatText, "":
+		handler = slog.NewTextHandler(os.Stdout, options)
+	default:
+		return nil, fmt.Errorf("unknown log format '%s'", config.LogFormat)
+	}
+
+	return &Logging{handler: handler, defaultLevel: defaultLevel, moduleLevels: moduleLevels}, nil
+}
+
+func ParseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if len(name) == 0 {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("unknown log level '%s'", name)
+	}
+	return level, nil
+}
+
+// Logger returns a logger for the module that respects the level configured for it
+func (app *Kosync) Logger(module string) *slog.Logger {
+	logging := app.Logging.Load()
+	if logging == nil {
+		return slog.Default().With("module", module)
+	}
+
+	level, found := logging.moduleLevels[strings.ToLower(module)]
+	if !found {
+		level = logging.defaultLevel
+	}
+	return slog.New(&levelHandler{level: level, handler: logging.handler}).With("module", module)
+}
+
+// RequestLogger returns a module logger that includes the request id and the authenticated user
+func (app *Kosync) RequestLogger(c *fiber.Ctx, module string) *slog.Logger {
+	logger := app.Logger(module)
+	if requestId, ok := c.Locals("requestid").(string); ok {
+		logger = logger.With("request_id", requestId)
+	}
+	if username, ok := c.Locals("current_user").(string); ok {
+		logger = logger.With("user", username)
+	}
+	return logger
+}
+
+// NewAccessLogMiddleware logs every request through the structured logger of the "Access" module
+func (app *Kosync) NewAccessLogMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		attrs := []any{
+			"status", status,
+			"latency", time.Since(start).String(),
+			"ip", c.IP(),
+			"method", c.Method(),
+			"path", c.Path(),
+		}
+		if err != nil {
+			if fiberErr, ok := err.(*fiber.Error); ok {
+				attrs[1] = fiberErr.Code
+			} else {
+				attrs[1] = fiber.StatusInternalServerError
+			}
+			attrs = append(attrs, "error", err.Error())
+		}
+		app.RequestLogger(c, "Access").Info("Request", attrs...)
+		return err
+	}
+}
+
+// levelHandler drops records below its level and passes everything else on
+type levelHandler struct {
+	level   slog.Level
+	handler slog.Handler
+}
+
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *levelHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.handler.Handle(ctx, record)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{level: h.level, handler: h.handler.WithAttrs(attrs)}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{level: h.level, handler: h.handler.WithGroup(name)}
+}
@@ -0,0 +1,173 @@
+//
+// File:        internal/kosync/metrics.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Minimal implementation of the Prometheus text exposition format, so KOsync does not need the client library
+
+var (
+	metricsDurationBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	httpRequestsTotal         = newCounterVec("kosync_http_requests_total", "Number of HTTP requests by route and status code.", "method", "route", "status")
+	httpRequestDuration       = newHistogramVec("kosync_http_request_duration_seconds", "Duration of HTTP requests by route.", metricsDurationBuckets, "method", "route")
+	authFailuresTotal         = newCounterVec("kosync_auth_failures_total", "Number of rejected authentications.", "reason")
+	progressPushesTotal       = newCounterVec("kosync_progress_pushes_total", "Number of progress pushes.")
+	userProgressPushesTotal   = newCounterVec("kosync_user_progress_pushes_total", "Number of progress pushes by user and device.", "user", "device")
+	databasePersistDuration   = newHistogramVec("kosync_database_persist_duration_seconds", "Duration of writing the database file.", metricsDurationBuckets)
+	databaseLockWaitDuration  = newHistogramVec("kosync_database_lock_wait_seconds", "Time spent waiting for the database lock.", metricsDurationBuckets)
+	backupsTotal              = newCounterVec("kosync_backups_total", "Number of backups by result.", "result")
+	backupUploadsTotal        = newCounterVec("kosync_backup_uploads_total", "Number of backup uploads to the backup remote by result.", "result")
+	metricsCollectorsInOrder  = []metricsCollector{httpRequestsTotal, httpRequestDuration, authFailuresTotal, progressPushesTotal, userProgressPushesTotal, databasePersistDuration, databaseLockWaitDuration, backupsTotal, backupUploadsTotal}
+	metricsLabelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+type metricsCollector interface {
+	Write(w io.Writer)
+}
+
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+	lock   sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+func (counter *counterVec) Inc(labelValues ...string) {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+	counter.values[formatLabels(counter.labels, labelValues, "")]++
+}
+
+func (counter *counterVec) Write(w io.Writer) {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", counter.name, counter.help, counter.name)
+	for _, labels := range sortedKeys(counter.values) {
+		_, _ = fmt.Fprintf(w, "%s%s %s\n", counter.name, labels, formatFloat(counter.values[labels]))
+	}
+}
+
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	lock    sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 // Cumulative count per bucket
+	count       uint64
+	sum         float64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+}
+
+func (histogram *histogramVec) Observe(value float64, labelValues ...string) {
+	histogram.lock.Lock()
+	defer histogram.lock.Unlock()
+
+	key := strings.Join(labelValues, "\x00")
+	series, found := histogram.series[key]
+	if !found {
+		series = &histogramSeries{labelValues: labelValues, counts: make([]uint64, len(histogram.buckets))}
+		histogram.series[key] = series
+	}
+	for i, bound := range histogram.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+func (histogram *histogramVec) Write(w io.Writer) {
+	histogram.lock.Lock()
+	defer histogram.lock.Unlock()
+
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", histogram.name, histogram.help, histogram.name)
+	for _, key := range sortedKeys(histogram.series) {
+		series := histogram.series[key]
+		for i, bound := range histogram.buckets {
+			le := fmt.Sprintf(`le="%s"`, formatFloat(bound))
+			_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", histogram.name, formatLabels(histogram.labels, series.labelValues, le), series.counts[i])
+		}
+		_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", histogram.name, formatLabels(histogram.labels, series.labelValues, `le="+Inf"`), series.count)
+		labels := formatLabels(histogram.labels, series.labelValues, "")
+		_, _ = fmt.Fprintf(w, "%s_sum%s %s\n", histogram.name, labels, formatFloat(series.sum))
+		_, _ = fmt.Fprintf(w, "%s_count%s %d\n", histogram.name, labels, series.count)
+	}
+}
+
+// WriteMetrics writes all metrics plus the gauges that are sampled on scrape
+func (app *Kosync) WriteMetrics(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "# HELP kosync_build_info Version of the KOsync server.\n# TYPE kosync_build_info gauge\n")
+	_, _ = fmt.Fprintf(w, "kosync_build_info%s 1\n", formatLabels([]string{"version"}, []string{Version}, ""))
+
+	_, _ = fmt.Fprintf(w, "# HELP kosync_database_size_bytes Size of the database file.\n# TYPE kosync_database_size_bytes gauge\n")
+	if size, err := databaseFileSize(app.DbFile); err == nil {
+		_, _ = fmt.Fprintf(w, "kosync_database_size_bytes %d\n", size)
+	}
+
+	for _, collector := range metricsCollectorsInOrder {
+		collector.Write(w)
+	}
+}
+
+func formatLabels(names, values []string, extra string) string {
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, metricsLabelValueReplacer.Replace(value)))
+	}
+	if len(extra) > 0 {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
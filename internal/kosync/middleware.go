@@ -7,10 +7,12 @@
 package kosync
 
 import (
-	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
 )
 
 func (app *Kosync) NewAuthMiddleware() fiber.Handler {
@@ -19,6 +21,17 @@ func (app *Kosync) NewAuthMiddleware() fiber.Handler {
 		"/syncs",
 		"/api/documents.all",
 		"/api/documents.update",
+		"/api/documents.metadata",
+		"/api/documents.merge",
+		"/api/documents.unmerge",
+		"/api/stats",
+		"/api/events",
+		"/api/webhooks",
+		"/api/me",
+		"/api/tenant",
+		"/api/audit",
+		"/api/backups",
+		"/api/database",
 	}
 
 	// Return new handler
@@ -37,21 +50,57 @@ func (app *Kosync) NewAuthMiddleware() fiber.Handler {
 		username := c.Get("x-auth-user")
 		password := c.Get("x-auth-key")
 
-		// try to find the user
-		user, found := app.Db.Users[username]
-		if !found {
-			app.PrintDebug("Auth", c.Locals("requestid").(string), fmt.Sprintf("Unauthorized request from unknown '%s'", username))
+		// try to find the user, users of tenants can only log in via their tenant.
+		// A username containing the separator would otherwise reach the users of a tenant from outside of it.
+		userId := UserKey(CurrentTenant(c), username)
+		app.LockDb()
+		user, found := app.Db.Users[userId]
+		app.DbLock.Unlock()
+		if !found || user.Tenant != CurrentTenant(c) {
+			authFailuresTotal.Inc("unknown_user")
+			app.Audit(c, AuditLoginFailed, "", map[string]string{"reason": "unknown_user", "username": userId})
+			app.RequestLogger(c, "Auth").Debug("Unauthorized request from unknown user", "username", username)
 			return fiber.ErrUnauthorized
 		}
 
 		// verify the passwords match (both are md5 hashed)
 		if user.Password != password {
-			app.PrintDebug("Auth", c.Locals("requestid").(string), fmt.Sprintf("Unauthorized request from user '%s'", username))
+			authFailuresTotal.Inc("wrong_key")
+			app.Audit(c, AuditLoginFailed, userId, map[string]string{"reason": "wrong_key"})
+			app.RequestLogger(c, "Auth").Debug("Unauthorized request, wrong key", "username", username)
 			return fiber.ErrUnauthorized
 		}
 
-		c.Locals("current_user", user.Username)
-		app.PrintDebug("Auth", c.Locals("requestid").(string), fmt.Sprintf("Authorized user '%s'", username))
+		// The header values are only valid during the request, the stored user outlives it
+		c.Locals("current_user", UserKey(user.Tenant, user.Username))
+		app.RequestLogger(c, "Auth").Debug("Authorized user")
 		return c.Next()
 	}
 }
+
+// NewMetricsMiddleware records count and duration of requests per route
+func (app *Kosync) NewMetricsMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if fiberErr, ok := err.(*fiber.Error); ok {
+				status = fiberErr.Code
+			}
+		}
+		// Requests without a route or rejected by a middleware would show up with the route of this middleware
+		route := c.Route().Path
+		if route == "/" && c.Path() != "/" {
+			route = "unmatched"
+		}
+		// The method string is only valid during the request, so it is copied before being stored
+		method := utils.CopyString(c.Method())
+
+		httpRequestsTotal.Inc(method, route, strconv.Itoa(status))
+		httpRequestDuration.Observe(time.Since(start).Seconds(), method, route)
+		return err
+	}
+}
@@ -0,0 +1,176 @@
+//
+// File:        internal/kosync/redis_client.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisScanCount is the number of keys requested per SCAN call
+const redisScanCount = "500"
+
+// ReadRedisRecords reads the users and documents of the KOReader sync server from a running Redis server.
+// The address has the format redis://[username:password@]host[:port][/database], rediss:// connects with TLS.
+func ReadRedisRecords(address string) ([]ExportRecord, error) {
+	client, err := dialRedis(address)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = client.conn.Close()
+	}()
+
+	records := make([]ExportRecord, 0)
+	cursor := "0"
+	for {
+		reply, err := client.command("SCAN", cursor, "MATCH", "user:*", "COUNT", redisScanCount)
+		if err != nil {
+			return nil, err
+		}
+		result, ok := reply.([]any)
+		if !ok || len(result) != 2 {
+			return nil, fmt.Errorf("unexpected reply to SCAN")
+		}
+		cursor, ok = result[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected reply to SCAN")
+		}
+		keys, err := respStrings(result[1])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			record, ok, err := client.readRecord(key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read key '%s': %w", key, err)
+			}
+			if ok {
+				records = append(records, record)
+			}
+		}
+		if cursor == "0" {
+			return records, nil
+		}
+	}
+}
+
+type redisClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialRedis(address string) (*redisClient, error) {
+	redisUrl, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	host := redisUrl.Host
+	if len(redisUrl.Port()) == 0 {
+		host = net.JoinHostPort(redisUrl.Hostname(), "6379")
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	switch redisUrl.Scheme {
+	case "redis":
+		conn, err = dialer.Dial("tcp", host)
+	case "rediss":
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: redisUrl.Hostname(), MinVersion: tls.VersionTLS12})
+	default:
+		return nil, fmt.Errorf("redis address must start with redis:// or rediss://")
+	}
+	if err != nil {
+		return nil, err
+	}
+	client := &redisClient{conn: conn, reader: bufio.NewReader(conn)}
+
+	if redisUrl.User != nil {
+		// redis://:password@host authenticates as the default user
+		args := []string{"AUTH", redisUrl.User.Username()}
+		if password, hasPassword := redisUrl.User.Password(); hasPassword {
+			args = append(args, password)
+			if len(redisUrl.User.Username()) == 0 {
+				args = []string{"AUTH", password}
+			}
+		}
+		if _, err := client.command(args...); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	if database := strings.Trim(redisUrl.Path, "/"); len(database) > 0 {
+		if _, err := strconv.Atoi(database); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("redis database '%s' is not a number", database)
+		}
+		if _, err := client.command("SELECT", database); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// command sends a command and returns its reply, error replies are returned as error
+func (client *redisClient) command(args ...string) (any, error) {
+	if err := client.conn.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		return nil, err
+	}
+	if err := writeRespCommand(client.conn, args...); err != nil {
+		return nil, err
+	}
+	reply, err := readRespValue(client.reader)
+	if err != nil {
+		return nil, err
+	}
+	if respErr, ok := reply.(RespError); ok {
+		return nil, fmt.Errorf("%s failed: %w", args[0], respErr)
+	}
+	return reply, nil
+}
+
+// readRecord reads a key of the KOReader sync server key layout, other keys are ignored
+func (client *redisClient) readRecord(key string) (ExportRecord, bool, error) {
+	switch {
+	case strings.HasSuffix(key, ":key"):
+		reply, err := client.command("GET", key)
+		if err != nil {
+			return ExportRecord{}, false, err
+		}
+		value, ok := reply.(string)
+		if !ok {
+			return ExportRecord{}, false, nil
+		}
+		record, ok := redisUserRecord(key, value)
+		return record, ok, nil
+	case strings.Contains(key, ":document:"):
+		reply, err := client.command("HGETALL", key)
+		if err != nil {
+			return ExportRecord{}, false, err
+		}
+		values, err := respStrings(reply)
+		if err != nil {
+			return ExportRecord{}, false, err
+		}
+		fields := make(map[string]string, len(values)/2)
+		for i := 0; i+1 < len(values); i += 2 {
+			fields[values[i]] = values[i+1]
+		}
+		record, ok := redisDocumentRecord(key, fields)
+		return record, ok, nil
+	default:
+		return ExportRecord{}, false, nil
+	}
+}
@@ -0,0 +1,214 @@
+//
+// File:        internal/kosync/redis_client_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testRedisServer is a minimal Redis stand-in that requires a password and returns SCAN results in pages of pageSize keys
+type testRedisServer struct {
+	password string
+	database string
+	pageSize int
+	keys     map[string]any
+	lock     sync.Mutex
+	scans    int
+}
+
+func newTestRedisServer(t *testing.T, password, database string, pageSize int, keys map[string]any) (*testRedisServer, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	server := &testRedisServer{password: password, database: database, pageSize: pageSize, keys: keys}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server, listener.Addr().String()
+}
+
+func (server *testRedisServer) serve(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	authenticated := len(server.password) == 0
+	for {
+		value, err := readRespValue(reader)
+		if err != nil {
+			return
+		}
+		args, err := respStrings(value)
+		if err != nil || len(args) == 0 {
+			_, _ = io.WriteString(conn, "-ERR Protocol error\r\n")
+			return
+		}
+
+		command := strings.ToUpper(args[0])
+		switch {
+		case command == "AUTH":
+			authenticated = args[len(args)-1] == server.password
+			if !authenticated {
+				_, _ = io.WriteString(conn, "-WRONGPASS invalid username-password pair or user is disabled.\r\n")
+				continue
+			}
+			_, _ = io.WriteString(conn, "+OK\r\n")
+		case !authenticated:
+			_, _ = io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+		case command == "SELECT":
+			if args[1] != server.database {
+				_, _ = io.WriteString(conn, "-ERR DB index is out of range\r\n")
+				continue
+			}
+			_, _ = io.WriteString(conn, "+OK\r\n")
+		default:
+			server.lock.Lock()
+			_, _ = io.WriteString(conn, server.reply(command, args[1:]))
+			server.lock.Unlock()
+		}
+	}
+}
+
+func (server *testRedisServer) reply(command string, args []string) string {
+	switch command {
+	case "SCAN":
+		server.scans++
+		keys := make([]string, 0, len(server.keys))
+		for key := range server.keys {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		// Like Redis, MATCH filters the keys of a page after the page was selected
+		start, _ := strconv.Atoi(args[0])
+		end := min(start+server.pageSize, len(keys))
+		pattern := ""
+		if len(args) >= 3 && strings.ToUpper(args[1]) == "MATCH" {
+			pattern = args[2]
+		}
+		matched := make([]string, 0)
+		for _, key := range keys[start:end] {
+			if ok, _ := path.Match(pattern, key); ok || len(pattern) == 0 {
+				matched = append(matched, key)
+			}
+		}
+		cursor := "0"
+		if end < len(keys) {
+			cursor = strconv.Itoa(end)
+		}
+		return fmt.Sprintf("*2\r\n$%d\r\n%s\r\n", len(cursor), cursor) + respArray(matched)
+	case "GET":
+		switch value := server.keys[args[0]].(type) {
+		case nil:
+			return "$-1\r\n"
+		case string:
+			return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+		}
+	case "HGETALL":
+		switch value := server.keys[args[0]].(type) {
+		case nil:
+			return "*0\r\n"
+		case map[string]string:
+			fields := make([]string, 0, len(value)*2)
+			for field, fieldValue := range value {
+				fields = append(fields, field, fieldValue)
+			}
+			return respArray(fields)
+		}
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", command)
+	}
+	return "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+}
+
+func respArray(values []string) string {
+	var reply strings.Builder
+	reply.WriteString(fmt.Sprintf("*%d\r\n", len(values)))
+	for _, value := range values {
+		reply.WriteString(fmt.Sprintf("$%d\r\n%s\r\n", len(value), value))
+	}
+	return reply.String()
+}
+
+// testKoreaderKeys are the keys of testKoreaderRecords together with keys the import ignores
+func testKoreaderKeys() map[string]any {
+	return map[string]any{
+		"user:alice:key": "0123456789abcdef0123456789abcdef",
+		"user:alice:document:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa": map[string]string{
+			"percentage": "0.25", "progress": "/body/p[1]", "device": "kobo", "device_id": "ID1", "timestamp": "1700000100",
+		},
+		"user:alice:document:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb": map[string]string{
+			"percentage": "0.5", "progress": "12", "device": "pb", "device_id": "ID2", "timestamp": "1700000200",
+		},
+		"user:bob:key": "bbbbbbbbbbbbbbbbbbbb",
+		"user:bob:document:cccccccccccccccccccccccccccccccc": map[string]string{
+			"percentage": "1", "progress": "99", "device": "kindle", "timestamp": "30000",
+		},
+		"user:carol:key":      "42",
+		"user:carol:settings": map[string]string{"theme": "dark"},
+		"session:alice":       "token",
+		"stats":               map[string]string{"users": "3"},
+	}
+}
+
+func TestReadRedisRecords(t *testing.T) {
+	server, address := newTestRedisServer(t, "secret", "2", 3, testKoreaderKeys())
+
+	records, err := ReadRedisRecords("redis://:secret@" + address + "/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertKoreaderRecords(t, records)
+	// Nine keys in pages of three
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if server.scans != 3 {
+		t.Errorf("reading needed %d SCAN requests, expected 3", server.scans)
+	}
+}
+
+func TestReadRedisRecordsErrors(t *testing.T) {
+	_, address := newTestRedisServer(t, "secret", "2", 3, testKoreaderKeys())
+	tests := []struct {
+		name    string
+		address string
+	}{
+		{"no password", "redis://" + address + "/2"},
+		{"wrong password", "redis://:wrong@" + address + "/2"},
+		{"unknown database", "redis://:secret@" + address + "/99"},
+		{"database is no number", "redis://:secret@" + address + "/first"},
+		{"unknown scheme", "http://" + address},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ReadRedisRecords(test.address); err == nil {
+				t.Error("reading succeeded")
+			}
+		})
+	}
+}
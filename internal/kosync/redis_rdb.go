@@ -0,0 +1,676 @@
+//
+// File:        internal/kosync/redis_rdb.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Opcodes and value types of the Redis RDB file format, see https://rdb.fnordig.de/file_format.html
+// and rdb.h of Redis for the types added by later versions.
+const (
+	rdbOpSlotInfo     = 0xF4
+	rdbOpFunction2    = 0xF5
+	rdbOpModuleAux    = 0xF7
+	rdbOpIdle         = 0xF8
+	rdbOpFreq         = 0xF9
+	rdbOpAux          = 0xFA
+	rdbOpResizeDb     = 0xFB
+	rdbOpExpireTimeMs = 0xFC
+	rdbOpExpireTime   = 0xFD
+	rdbOpSelectDb     = 0xFE
+	rdbOpEof          = 0xFF
+
+	rdbTypeString          = 0
+	rdbTypeList            = 1
+	rdbTypeSet             = 2
+	rdbTypeZset            = 3
+	rdbTypeHash            = 4
+	rdbTypeZset2           = 5
+	rdbTypeHashZipmap      = 9
+	rdbTypeListZiplist     = 10
+	rdbTypeSetIntset       = 11
+	rdbTypeZsetZiplist     = 12
+	rdbTypeHashZiplist     = 13
+	rdbTypeListQuicklist   = 14
+	rdbTypeHashListpack    = 16
+	rdbTypeZsetListpack    = 17
+	rdbTypeListQuicklist2  = 18
+	rdbTypeSetListpack     = 20
+	rdbTypeHashMetadata    = 24
+	rdbTypeHashListpackEx  = 25
+	rdbEncodingInt8        = 0
+	rdbEncodingInt16       = 1
+	rdbEncodingInt32       = 2
+	rdbEncodingLzf         = 3
+	rdbMaxSupportedVersion = 12
+)
+
+// ReadRdbRecords reads the users and documents of the KOReader sync server from a Redis RDB dump
+func ReadRdbRecords(r io.Reader) ([]ExportRecord, error) {
+	records := make([]ExportRecord, 0)
+	err := parseRdb(bufio.NewReader(r), func(key string, value any) {
+		switch value := value.(type) {
+		case string:
+			if record, ok := redisUserRecord(key, value); ok {
+				records = append(records, record)
+			}
+		case map[string]string:
+			if record, ok := redisDocumentRecord(key, value); ok {
+				records = append(records, record)
+			}
+		}
+	})
+	return records, err
+}
+
+// parseRdb calls fn for every string and hash in the dump, values of other types are skipped
+func parseRdb(r *bufio.Reader, fn func(key string, value any)) error {
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("not a Redis RDB file: %w", err)
+	}
+	if string(header[:5]) != "REDIS" {
+		return fmt.Errorf("not a Redis RDB file")
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil || version > rdbMaxSupportedVersion {
+		return fmt.Errorf("RDB version '%s' is not supported", header[5:])
+	}
+
+	p := rdbParser{r: r}
+	for {
+		opcode, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch opcode {
+		case rdbOpEof:
+			return nil
+		case rdbOpAux:
+			if _, err := p.readString(); err != nil {
+				return err
+			}
+			if _, err := p.readString(); err != nil {
+				return err
+			}
+		case rdbOpResizeDb:
+			if _, err := p.readLength(); err != nil {
+				return err
+			}
+			if _, err := p.readLength(); err != nil {
+				return err
+			}
+		case rdbOpSelectDb, rdbOpIdle:
+			if _, err := p.readLength(); err != nil {
+				return err
+			}
+		case rdbOpSlotInfo:
+			for i := 0; i < 3; i++ {
+				if _, err := p.readLength(); err != nil {
+					return err
+				}
+			}
+		case rdbOpFreq:
+			if _, err := r.ReadByte(); err != nil {
+				return err
+			}
+		case rdbOpExpireTime:
+			if _, err := p.readBytes(4); err != nil {
+				return err
+			}
+		case rdbOpExpireTimeMs:
+			if _, err := p.readBytes(8); err != nil {
+				return err
+			}
+		case rdbOpFunction2:
+			if _, err := p.readString(); err != nil {
+				return err
+			}
+		case rdbOpModuleAux:
+			return fmt.Errorf("RDB files with module data are not supported")
+		default:
+			key, err := p.readString()
+			if err != nil {
+				return err
+			}
+			value, err := p.readValue(opcode)
+			if err != nil {
+				return fmt.Errorf("failed to read value of key '%s': %w", key, err)
+			}
+			if value != nil {
+				fn(key, value)
+			}
+		}
+	}
+}
+
+type rdbParser struct {
+	r *bufio.Reader
+}
+
+func (p *rdbParser) readBytes(n int) ([]byte, error) {
+	if n < 0 || n > respMaxLength {
+		return nil, fmt.Errorf("invalid length %d", n)
+	}
+	data := make([]byte, n)
+	_, err := io.ReadFull(p.r, data)
+	return data, err
+}
+
+// readLengthEncoding returns the length, or the special encoding when encoded is set
+func (p *rdbParser) readLengthEncoding() (length uint64, encoded bool, err error) {
+	first, err := p.r.ReadByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch first >> 6 {
+	case 0:
+		return uint64(first & 0x3F), false, nil
+	case 1:
+		next, err := p.r.ReadByte()
+		return uint64(first&0x3F)<<8 | uint64(next), false, err
+	case 2:
+		switch first {
+		case 0x80:
+			data, err := p.readBytes(4)
+			if err != nil {
+				return 0, false, err
+			}
+			return uint64(binary.BigEndian.Uint32(data)), false, nil
+		case 0x81:
+			data, err := p.readBytes(8)
+			if err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(data), false, nil
+		default:
+			return 0, false, fmt.Errorf("invalid length encoding 0x%02x", first)
+		}
+	default:
+		return uint64(first & 0x3F), true, nil
+	}
+}
+
+func (p *rdbParser) readLength() (int, error) {
+	length, encoded, err := p.readLengthEncoding()
+	if err != nil {
+		return 0, err
+	}
+	if encoded || length > respMaxLength {
+		return 0, fmt.Errorf("invalid length")
+	}
+	return int(length), nil
+}
+
+func (p *rdbParser) readString() (string, error) {
+	length, encoded, err := p.readLengthEncoding()
+	if err != nil {
+		return "", err
+	}
+	if !encoded {
+		if length > respMaxLength {
+			return "", fmt.Errorf("invalid string length %d", length)
+		}
+		data, err := p.readBytes(int(length))
+		return string(data), err
+	}
+
+	switch length {
+	case rdbEncodingInt8:
+		b, err := p.r.ReadByte()
+		return strconv.Itoa(int(int8(b))), err
+	case rdbEncodingInt16:
+		data, err := p.readBytes(2)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(data)))), nil
+	case rdbEncodingInt32:
+		data, err := p.readBytes(4)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(data)))), nil
+	case rdbEncodingLzf:
+		compressedLength, err := p.readLength()
+		if err != nil {
+			return "", err
+		}
+		length, err := p.readLength()
+		if err != nil {
+			return "", err
+		}
+		compressed, err := p.readBytes(compressedLength)
+		if err != nil {
+			return "", err
+		}
+		data, err := lzfDecompress(compressed, length)
+		return string(data), err
+	default:
+		return "", fmt.Errorf("invalid string encoding %d", length)
+	}
+}
+
+// readValue reads a value of the type, strings are returned as string, hashes as map[string]string and all other types as nil
+func (p *rdbParser) readValue(valueType byte) (any, error) {
+	switch valueType {
+	case rdbTypeString:
+		return p.readString()
+	case rdbTypeList, rdbTypeSet:
+		return nil, p.skipStrings(1)
+	case rdbTypeZset:
+		// Scores are stored as strings
+		return nil, p.skipStrings(2)
+	case rdbTypeZset2:
+		count, err := p.readLength()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < count; i++ {
+			if _, err := p.readString(); err != nil {
+				return nil, err
+			}
+			if _, err := p.readBytes(8); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	case rdbTypeHash:
+		count, err := p.readLength()
+		if err != nil {
+			return nil, err
+		}
+		hash := make(map[string]string, min(count, 1024))
+		for i := 0; i < count; i++ {
+			field, err := p.readString()
+			if err != nil {
+				return nil, err
+			}
+			value, err := p.readString()
+			if err != nil {
+				return nil, err
+			}
+			hash[field] = value
+		}
+		return hash, nil
+	case rdbTypeHashMetadata:
+		// Hash with field expiration: minimum expire time, then a ttl before every field
+		if _, err := p.readBytes(8); err != nil {
+			return nil, err
+		}
+		count, err := p.readLength()
+		if err != nil {
+			return nil, err
+		}
+		hash := make(map[string]string, min(count, 1024))
+		for i := 0; i < count; i++ {
+			if _, _, err := p.readLengthEncoding(); err != nil {
+				return nil, err
+			}
+			field, err := p.readString()
+			if err != nil {
+				return nil, err
+			}
+			value, err := p.readString()
+			if err != nil {
+				return nil, err
+			}
+			hash[field] = value
+		}
+		return hash, nil
+	case rdbTypeHashZipmap:
+		data, err := p.readString()
+		if err != nil {
+			return nil, err
+		}
+		entries, err := parseZipmap([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+		return pairsToHash(entries, 2), nil
+	case rdbTypeHashZiplist:
+		data, err := p.readString()
+		if err != nil {
+			return nil, err
+		}
+		entries, err := parseZiplist([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+		return pairsToHash(entries, 2), nil
+	case rdbTypeHashListpack, rdbTypeHashListpackEx:
+		if valueType == rdbTypeHashListpackEx {
+			if _, err := p.readBytes(8); err != nil {
+				return nil, err
+			}
+		}
+		data, err := p.readString()
+		if err != nil {
+			return nil, err
+		}
+		entries, err := parseListpack([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+		// Hashes with field expiration store field, value and ttl
+		if valueType == rdbTypeHashListpackEx {
+			return pairsToHash(entries, 3), nil
+		}
+		return pairsToHash(entries, 2), nil
+	case rdbTypeListZiplist, rdbTypeSetIntset, rdbTypeZsetZiplist, rdbTypeZsetListpack, rdbTypeSetListpack:
+		_, err := p.readString()
+		return nil, err
+	case rdbTypeListQuicklist:
+		return nil, p.skipStrings(1)
+	case rdbTypeListQuicklist2:
+		count, err := p.readLength()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < count; i++ {
+			if _, err := p.readLength(); err != nil {
+				return nil, err
+			}
+			if _, err := p.readString(); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("value type %d is not supported", valueType)
+	}
+}
+
+// skipStrings skips a length prefixed list of strings, with stride strings per element
+func (p *rdbParser) skipStrings(stride int) error {
+	count, err := p.readLength()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count*stride; i++ {
+		if _, err := p.readString(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pairsToHash turns field and value entries into a hash, entries beyond the value of each group are ignored
+func pairsToHash(entries []string, stride int) map[string]string {
+	hash := make(map[string]string, len(entries)/stride)
+	for i := 0; i+1 < len(entries); i += stride {
+		hash[entries[i]] = entries[i+1]
+	}
+	return hash
+}
+
+// lzfDecompress decompresses the LZF compressed strings of RDB files
+func lzfDecompress(in []byte, length int) ([]byte, error) {
+	out := make([]byte, 0, length)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			// Literal run of ctrl+1 bytes
+			end := i + ctrl + 1
+			if end > len(in) {
+				return nil, fmt.Errorf("invalid LZF data")
+			}
+			out = append(out, in[i:end]...)
+			i = end
+			continue
+		}
+
+		// Back reference
+		refLength := ctrl >> 5
+		if refLength == 7 {
+			if i >= len(in) {
+				return nil, fmt.Errorf("invalid LZF data")
+			}
+			refLength += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, fmt.Errorf("invalid LZF data")
+		}
+		ref := len(out) - ((ctrl & 0x1F) << 8) - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, fmt.Errorf("invalid LZF data")
+		}
+		for j := 0; j < refLength+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != length {
+		return nil, fmt.Errorf("LZF data has length %d, expected %d", len(out), length)
+	}
+	return out, nil
+}
+
+// parseZiplist returns the entries of a ziplist, integers are formatted as strings
+func parseZiplist(data []byte) ([]string, error) {
+	if len(data) < 11 {
+		return nil, fmt.Errorf("invalid ziplist")
+	}
+	entries := make([]string, 0, binary.LittleEndian.Uint16(data[8:10]))
+	for i := 10; i < len(data); {
+		if data[i] == 0xFF {
+			return entries, nil
+		}
+		// Length of the previous entry
+		if data[i] == 0xFE {
+			i += 5
+		} else {
+			i++
+		}
+		if i >= len(data) {
+			break
+		}
+
+		encoding := data[i]
+		var value string
+		var size int
+		switch {
+		case encoding>>6 == 0:
+			size = 1 + int(encoding&0x3F)
+			value, i = ziplistString(data, i+1, int(encoding&0x3F))
+		case encoding>>6 == 1:
+			if i+1 >= len(data) {
+				return nil, fmt.Errorf("invalid ziplist")
+			}
+			length := int(encoding&0x3F)<<8 | int(data[i+1])
+			size = 2 + length
+			value, i = ziplistString(data, i+2, length)
+		case encoding>>6 == 2:
+			if i+4 >= len(data) {
+				return nil, fmt.Errorf("invalid ziplist")
+			}
+			length := int(binary.BigEndian.Uint32(data[i+1 : i+5]))
+			size = 5 + length
+			value, i = ziplistString(data, i+5, length)
+		default:
+			var integer int64
+			var intSize int
+			switch encoding {
+			case 0xC0:
+				intSize = 2
+			case 0xD0:
+				intSize = 4
+			case 0xE0:
+				intSize = 8
+			case 0xF0:
+				intSize = 3
+			case 0xFE:
+				intSize = 1
+			default:
+				// Immediate values 0 to 12
+				integer = int64(encoding&0x0F) - 1
+			}
+			if i+1+intSize > len(data) {
+				return nil, fmt.Errorf("invalid ziplist")
+			}
+			if intSize > 0 {
+				integer = littleEndianSigned(data[i+1 : i+1+intSize])
+			}
+			size = 1 + intSize
+			value = strconv.FormatInt(integer, 10)
+			i += size
+		}
+		if i > len(data) || size <= 0 {
+			return nil, fmt.Errorf("invalid ziplist")
+		}
+		entries = append(entries, value)
+	}
+	return nil, fmt.Errorf("ziplist is not terminated")
+}
+
+func ziplistString(data []byte, start, length int) (string, int) {
+	end := min(start+length, len(data)+1)
+	if end > len(data) {
+		return "", len(data) + 1
+	}
+	return string(data[start:end]), end
+}
+
+// parseListpack returns the entries of a listpack, integers are formatted as strings
+func parseListpack(data []byte) ([]string, error) {
+	if len(data) < 7 {
+		return nil, fmt.Errorf("invalid listpack")
+	}
+	entries := make([]string, 0, binary.LittleEndian.Uint16(data[4:6]))
+	for i := 6; i < len(data); {
+		encoding := data[i]
+		if encoding == 0xFF {
+			return entries, nil
+		}
+
+		var value string
+		var size int
+		switch {
+		case encoding>>7 == 0:
+			value, size = strconv.Itoa(int(encoding&0x7F)), 1
+		case encoding>>6 == 2:
+			length := int(encoding & 0x3F)
+			size = 1 + length
+			if i+size > len(data) {
+				return nil, fmt.Errorf("invalid listpack")
+			}
+			value = string(data[i+1 : i+size])
+		case encoding>>5 == 6:
+			if i+1 >= len(data) {
+				return nil, fmt.Errorf("invalid listpack")
+			}
+			integer := int(encoding&0x1F)<<8 | int(data[i+1])
+			if integer >= 1<<12 {
+				integer -= 1 << 13
+			}
+			value, size = strconv.Itoa(integer), 2
+		case encoding>>4 == 14:
+			if i+1 >= len(data) {
+				return nil, fmt.Errorf("invalid listpack")
+			}
+			length := int(encoding&0x0F)<<8 | int(data[i+1])
+			size = 2 + length
+			if i+size > len(data) {
+				return nil, fmt.Errorf("invalid listpack")
+			}
+			value = string(data[i+2 : i+size])
+		case encoding == 0xF0:
+			if i+5 > len(data) {
+				return nil, fmt.Errorf("invalid listpack")
+			}
+			length := int(binary.LittleEndian.Uint32(data[i+1 : i+5]))
+			size = 5 + length
+			if length < 0 || i+size > len(data) {
+				return nil, fmt.Errorf("invalid listpack")
+			}
+			value = string(data[i+5 : i+size])
+		case encoding >= 0xF1 && encoding <= 0xF4:
+			intSize := map[byte]int{0xF1: 2, 0xF2: 3, 0xF3: 4, 0xF4: 8}[encoding]
+			size = 1 + intSize
+			if i+size > len(data) {
+				return nil, fmt.Errorf("invalid listpack")
+			}
+			value = strconv.FormatInt(littleEndianSigned(data[i+1:i+size]), 10)
+		default:
+			return nil, fmt.Errorf("invalid listpack encoding 0x%02x", encoding)
+		}
+		entries = append(entries, value)
+		i += size + listpackBacklenSize(size)
+	}
+	return nil, fmt.Errorf("listpack is not terminated")
+}
+
+// listpackBacklenSize returns the number of bytes used to store the length of an entry after it
+func listpackBacklenSize(size int) int {
+	switch {
+	case size <= 127:
+		return 1
+	case size < 16383:
+		return 2
+	case size < 2097151:
+		return 3
+	case size < 268435455:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// parseZipmap returns the keys and values of a zipmap, the hash encoding of Redis before 2.6
+func parseZipmap(data []byte) ([]string, error) {
+	entries := make([]string, 0)
+	for i := 1; i < len(data); {
+		if data[i] == 0xFF {
+			return entries, nil
+		}
+		for _, isValue := range []bool{false, true} {
+			if i >= len(data) {
+				return nil, fmt.Errorf("invalid zipmap")
+			}
+			length := int(data[i])
+			i++
+			if length == 254 {
+				if i+4 > len(data) {
+					return nil, fmt.Errorf("invalid zipmap")
+				}
+				length = int(binary.LittleEndian.Uint32(data[i : i+4]))
+				i += 4
+			}
+			free := 0
+			if isValue {
+				if i >= len(data) {
+					return nil, fmt.Errorf("invalid zipmap")
+				}
+				free = int(data[i])
+				i++
+			}
+			if length < 0 || i+length > len(data) {
+				return nil, fmt.Errorf("invalid zipmap")
+			}
+			entries = append(entries, string(data[i:i+length]))
+			i += length + free
+		}
+	}
+	return nil, fmt.Errorf("zipmap is not terminated")
+}
+
+// littleEndianSigned decodes a little endian two's complement integer of 1 to 8 bytes
+func littleEndianSigned(data []byte) int64 {
+	var value uint64
+	for i := len(data) - 1; i >= 0; i-- {
+		value = value<<8 | uint64(data[i])
+	}
+	shift := uint(64 - 8*len(data))
+	return int64(value<<shift) >> shift
+}
@@ -0,0 +1,99 @@
+//
+// File:        internal/kosync/redis_rdb_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bytes"
+	"cmp"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// testdata/redis/koreader_sync_server.rdb is a dump of version 11 in the key layout of the KOReader sync server.
+// It contains the passwords of alice as plain string, of bob LZF compressed and of carol as integer with an expiry,
+// the documents as plain hash, listpack and ziplist, and a list, sorted set, set and idle time that are skipped.
+func testKoreaderRecords() []ExportRecord {
+	document := func(username, documentId string, percentage float32, progress, device, deviceId string, timestamp int64) ExportRecord {
+		return ExportRecord{
+			Type:       ExportRecordDocument,
+			Username:   username,
+			DocumentId: documentId,
+			Entry: &FileData{
+				ProgressData: ProgressData{Percentage: percentage, Progress: progress, Device: device, DeviceId: deviceId},
+				DocumentId:   documentId,
+				Timestamp:    timestamp,
+			},
+		}
+	}
+	return []ExportRecord{
+		{Type: ExportRecordUser, Username: "alice", Password: "0123456789abcdef0123456789abcdef"},
+		document("alice", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", 0.25, "/body/p[1]", "kobo", "ID1", 1700000100),
+		document("alice", "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", 0.5, "12", "pb", "ID2", 1700000200),
+		{Type: ExportRecordUser, Username: "bob", Password: "bbbbbbbbbbbbbbbbbbbb"},
+		document("bob", "cccccccccccccccccccccccccccccccc", 1, "99", "kindle", "", 30000),
+		{Type: ExportRecordUser, Username: "carol", Password: "42"},
+	}
+}
+
+// assertKoreaderRecords compares the records independent of their order, Redis does not order its keys
+func assertKoreaderRecords(t *testing.T, records []ExportRecord) {
+	t.Helper()
+	sorted := slices.Clone(records)
+	slices.SortFunc(sorted, func(a, b ExportRecord) int {
+		return cmp.Or(cmp.Compare(a.Username, b.Username), cmp.Compare(a.DocumentId, b.DocumentId))
+	})
+	expected := testKoreaderRecords()
+	if len(sorted) != len(expected) {
+		t.Fatalf("read %d records, expected %d: %+v", len(sorted), len(expected), sorted)
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(sorted[i], expected[i]) {
+			t.Errorf("record %d is %+v %+v, expected %+v %+v", i, sorted[i], sorted[i].Entry, expected[i], expected[i].Entry)
+		}
+	}
+}
+
+func readRdbFixture(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "redis", "koreader_sync_server.rdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestReadRdbRecords(t *testing.T) {
+	records, err := ReadRdbRecords(bytes.NewReader(readRdbFixture(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertKoreaderRecords(t, records)
+}
+
+func TestReadRdbRecordsRejectsInvalidDumps(t *testing.T) {
+	data := readRdbFixture(t)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"no RDB file", []byte(`{"schema": 18}`)},
+		{"newer version", append([]byte("REDIS0099"), data[9:]...)},
+		{"truncated", data[:len(data)/2]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ReadRdbRecords(bytes.NewReader(test.data)); err == nil {
+				t.Error("reading the dump succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+//
+// File:        internal/kosync/resp.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// respMaxLength limits bulk strings and arrays read from the Redis serialization protocol
+const respMaxLength = 512 * 1024 * 1024
+
+// RespError is an error reply of the Redis serialization protocol
+type RespError string
+
+func (e RespError) Error() string {
+	return string(e)
+}
+
+// writeRespCommand writes a command as an array of bulk strings, the format of redis-cli --pipe
+func writeRespCommand(w io.Writer, args ...string) error {
+	var command strings.Builder
+	command.WriteString(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, arg := range args {
+		command.WriteString(fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg))
+	}
+	_, err := io.WriteString(w, command.String())
+	return err
+}
+
+// readRespValue reads one value of the Redis serialization protocol.
+// Simple and bulk strings are returned as string, integers as int64, arrays as []any and null values as nil.
+// Error replies are returned as value of type RespError, the error is only set when the stream is broken.
+func readRespValue(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+	if len(line) == 0 {
+		return nil, fmt.Errorf("invalid RESP value: empty line")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return RespError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length > respMaxLength {
+			return nil, fmt.Errorf("invalid RESP bulk string length '%s'", line[1:])
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:length]), nil
+	case '*':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length > respMaxLength {
+			return nil, fmt.Errorf("invalid RESP array length '%s'", line[1:])
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		values := make([]any, 0, min(length, 1024))
+		for i := 0; i < length; i++ {
+			value, err := readRespValue(r)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("invalid RESP type '%c'", line[0])
+	}
+}
+
+// respStrings converts an array reply of strings
+func respStrings(value any) ([]string, error) {
+	values, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a RESP array, got %T", value)
+	}
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a RESP string, got %T", v)
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
@@ -0,0 +1,189 @@
+//
+// File:        internal/kosync/stats.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// StatsSessionGap is the longest pause between two progress pushes that still counts as reading time
+	StatsSessionGap = 30 * 60
+)
+
+type StatsData struct {
+	GeneratedAt   int64             `json:"generated_at"`
+	ReadingTime   int64             `json:"reading_time"` // Estimated reading time in seconds
+	BooksStarted  int               `json:"books_started"`
+	BooksFinished int               `json:"books_finished"`
+	CurrentStreak int               `json:"current_streak"` // Consecutive days with reading activity up to today
+	LongestStreak int               `json:"longest_streak"`
+	Days          []StatsDayData    `json:"days"`
+	Devices       []StatsDeviceData `json:"devices"`
+}
+
+type StatsDayData struct {
+	Date        string  `json:"date"`
+	ReadingTime int64   `json:"reading_time"`
+	Percentage  float32 `json:"percentage"` // Sum of forward progress over all documents, 1 is one whole document
+	Pushes      int     `json:"pushes"`
+}
+
+type StatsDeviceData struct {
+	Device   string `json:"device"`
+	DeviceId string `json:"device_id"`
+	Pushes   int    `json:"pushes"`
+	LastSeen int64  `json:"last_seen"`
+}
+
+// GetStats returns the cached statistics of a user or computes them when there are none.
+// Statistics of a previous day are recomputed, as the current streak is relative to today
+func (app *Kosync) GetStats(username string) (StatsData, bool) {
+	now := time.Now()
+	app.StatsLock.Lock()
+	stats, found := app.StatsCache[username]
+	generation := app.StatsGeneration
+	app.StatsLock.Unlock()
+	if found && time.Unix(stats.GeneratedAt, 0).Format(time.DateOnly) == now.Format(time.DateOnly) {
+		return stats, true
+	}
+
+	app.LockDb()
+	user, found := app.Db.Users[username]
+	if !found {
+		app.DbLock.Unlock()
+		return StatsData{}, false
+	}
+	stats = ComputeStats(user, now)
+	app.DbLock.Unlock()
+
+	app.StatsLock.Lock()
+	defer app.StatsLock.Unlock()
+	// An invalidation while computing may have dropped newer data, these statistics are returned but not cached
+	if generation != app.StatsGeneration {
+		return stats, true
+	}
+	if app.StatsCache == nil {
+		app.StatsCache = make(map[string]StatsData)
+	}
+	app.StatsCache[username] = stats
+	return stats, true
+}
+
+// InvalidateStats drops the cached statistics of a user, they get recomputed on the next request
+func (app *Kosync) InvalidateStats(username string) {
+	app.StatsLock.Lock()
+	defer app.StatsLock.Unlock()
+	app.StatsGeneration++
+	delete(app.StatsCache, username)
+}
+
+// ClearStats drops the cached statistics of all users, used when the whole database changes
+func (app *Kosync) ClearStats() {
+	app.StatsLock.Lock()
+	defer app.StatsLock.Unlock()
+	app.StatsGeneration++
+	app.StatsCache = nil
+}
+
+// ComputeStats derives reading statistics from the documents and history of a user
+func ComputeStats(user UserData, now time.Time) StatsData {
+	stats := StatsData{
+		GeneratedAt: now.Unix(),
+		Days:        make([]StatsDayData, 0),
+		Devices:     make([]StatsDeviceData, 0),
+	}
+	days := make(map[string]*StatsDayData)
+	devices := make(map[string]*StatsDeviceData)
+
+	for docId, doc := range user.Documents {
+		if doc.Percentage > 0 {
+			stats.BooksStarted++
+		}
+		if doc.Percentage >= FinishedPercentage {
+			stats.BooksFinished++
+		}
+
+		// Build the timeline of the document, the first history entry of a document is empty and skipped
+		timeline := make([]FileData, 0, len(user.History[docId].DocumentHistory)+1)
+		for _, entry := range user.History[docId].DocumentHistory {
+			if entry.Timestamp > 0 {
+				timeline = append(timeline, entry)
+			}
+		}
+		timeline = append(timeline, doc)
+		sort.SliceStable(timeline, func(i, j int) bool {
+			return timeline[i].Timestamp < timeline[j].Timestamp
+		})
+
+		for i, entry := range timeline {
+			dayKey := time.Unix(entry.Timestamp, 0).In(now.Location()).Format(time.DateOnly)
+			day, found := days[dayKey]
+			if !found {
+				day = &StatsDayData{Date: dayKey}
+				days[dayKey] = day
+			}
+			day.Pushes++
+
+			deviceKey := entry.DeviceId + "\x00" + entry.Device
+			device, found := devices[deviceKey]
+			if !found {
+				device = &StatsDeviceData{Device: entry.Device, DeviceId: entry.DeviceId}
+				devices[deviceKey] = device
+			}
+			device.Pushes++
+			device.LastSeen = max(device.LastSeen, entry.Timestamp)
+
+			if i == 0 {
+				continue
+			}
+			previous := timeline[i-1]
+			if gap := entry.Timestamp - previous.Timestamp; gap <= StatsSessionGap {
+				day.ReadingTime += gap
+				stats.ReadingTime += gap
+			}
+			if delta := entry.Percentage - previous.Percentage; delta > 0 {
+				day.Percentage += delta
+			}
+		}
+	}
+
+	for _, day := range days {
+		stats.Days = append(stats.Days, *day)
+	}
+	sort.Slice(stats.Days, func(i, j int) bool {
+		return stats.Days[i].Date < stats.Days[j].Date
+	})
+
+	for _, device := range devices {
+		stats.Devices = append(stats.Devices, *device)
+	}
+	sort.Slice(stats.Devices, func(i, j int) bool {
+		return stats.Devices[i].LastSeen > stats.Devices[j].LastSeen
+	})
+
+	// Streaks count consecutive calendar days with at least one push
+	streak := 0
+	var lastDay time.Time
+	for _, day := range stats.Days {
+		date, _ := time.ParseInLocation(time.DateOnly, day.Date, now.Location())
+		if streak > 0 && date.Equal(lastDay.AddDate(0, 0, 1)) {
+			streak++
+		} else {
+			streak = 1
+		}
+		lastDay = date
+		stats.LongestStreak = max(stats.LongestStreak, streak)
+	}
+	today, _ := time.ParseInLocation(time.DateOnly, now.Format(time.DateOnly), now.Location())
+	if streak > 0 && (lastDay.Equal(today) || lastDay.Equal(today.AddDate(0, 0, -1))) {
+		stats.CurrentStreak = streak
+	}
+
+	return stats
+}
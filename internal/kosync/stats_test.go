@@ -0,0 +1,125 @@
+//
+// File:        internal/kosync/stats_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// testStatsPush returns a push of the document at the time
+func testStatsPush(at time.Time, percentage float32, device string) FileData {
+	return FileData{ProgressData: ProgressData{Percentage: percentage, Device: device, DeviceId: device}, Timestamp: at.Unix()}
+}
+
+// testStatsUser reads one document on four days in the week before now and finishes another one
+func testStatsUser(now time.Time) UserData {
+	day := func(offset, hour, minute int) time.Time {
+		return time.Date(now.Year(), now.Month(), now.Day()+offset, hour, minute, 0, 0, now.Location())
+	}
+	return UserData{
+		Documents: map[string]FileData{
+			"reading":  testStatsPush(day(0, 9, 0), 0.5, "phone"),
+			"finished": testStatsPush(day(-4, 11, 0), 1, "kobo"),
+		},
+		History: map[string]HistoryData{
+			"reading": {DocumentHistory: []FileData{
+				{}, // The first history entry of a document is empty
+				testStatsPush(day(-4, 10, 0), 0.1, "kobo"),
+				testStatsPush(day(-4, 10, 10), 0.2, "kobo"),
+				testStatsPush(day(-3, 10, 0), 0.3, "kobo"),
+				testStatsPush(day(-1, 23, 30), 0.4, "kobo"),
+			}},
+		},
+	}
+}
+
+func TestComputeStats(t *testing.T) {
+	now := time.Date(2026, 4, 10, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	stats := ComputeStats(testStatsUser(now), now)
+
+	if stats.BooksStarted != 2 || stats.BooksFinished != 1 || stats.ReadingTime != 600 {
+		t.Errorf("started %d, finished %d, reading time %d", stats.BooksStarted, stats.BooksFinished, stats.ReadingTime)
+	}
+	if stats.CurrentStreak != 2 || stats.LongestStreak != 2 {
+		t.Errorf("current streak %d, longest streak %d", stats.CurrentStreak, stats.LongestStreak)
+	}
+
+	expected := []StatsDayData{
+		{Date: "2026-04-06", ReadingTime: 600, Percentage: 0.1, Pushes: 3},
+		{Date: "2026-04-07", Percentage: 0.1, Pushes: 1},
+		{Date: "2026-04-09", Percentage: 0.1, Pushes: 1},
+		{Date: "2026-04-10", Percentage: 0.1, Pushes: 1},
+	}
+	if len(stats.Days) != len(expected) {
+		t.Fatalf("days are %+v", stats.Days)
+	}
+	for i, day := range stats.Days {
+		if day.Date != expected[i].Date || day.ReadingTime != expected[i].ReadingTime || day.Pushes != expected[i].Pushes ||
+			math.Abs(float64(day.Percentage-expected[i].Percentage)) > 1e-6 {
+			t.Errorf("day %d is %+v, expected %+v", i, day, expected[i])
+		}
+	}
+
+	if len(stats.Devices) != 2 || stats.Devices[0].Device != "phone" || stats.Devices[1].Device != "kobo" || stats.Devices[1].Pushes != 5 {
+		t.Errorf("devices are %+v", stats.Devices)
+	}
+}
+
+func TestComputeStatsBucketsDaysInTheLocationOfNow(t *testing.T) {
+	now := time.Date(2026, 4, 10, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	user := testStatsUser(now)
+
+	// 23:30 of the previous day in CEST is already today in a zone three hours ahead
+	ahead := now.In(time.FixedZone("UTC+5", 5*60*60))
+	stats := ComputeStats(user, ahead)
+	if last := stats.Days[len(stats.Days)-1]; last.Date != "2026-04-10" || last.Pushes != 2 {
+		t.Errorf("last day is %+v", last)
+	}
+	if stats.CurrentStreak != 1 {
+		t.Errorf("current streak is %d", stats.CurrentStreak)
+	}
+}
+
+func TestComputeStatsEndsTheCurrentStreak(t *testing.T) {
+	now := time.Date(2026, 4, 10, 12, 0, 0, 0, time.UTC)
+	user := testStatsUser(now)
+
+	if stats := ComputeStats(user, now.AddDate(0, 0, 1)); stats.CurrentStreak != 2 {
+		t.Errorf("current streak the next day is %d", stats.CurrentStreak)
+	}
+	if stats := ComputeStats(user, now.AddDate(0, 0, 2)); stats.CurrentStreak != 0 || stats.LongestStreak != 2 {
+		t.Errorf("current streak after a day without reading is %d, longest is %d", stats.CurrentStreak, stats.LongestStreak)
+	}
+}
+
+func TestGetStatsRecomputesOnANewDay(t *testing.T) {
+	app := newTestApp(t)
+	addTestUser(app, "", "alice")
+	user := app.Db.Users["alice"]
+	user.Documents["0123456789abcdef0123456789abcdef"] = testStatsPush(time.Now(), 0.5, "kobo")
+	app.Db.Users["alice"] = user
+
+	app.StatsCache = map[string]StatsData{"alice": {GeneratedAt: time.Now().Unix(), CurrentStreak: 42}}
+	if stats, _ := app.GetStats("alice"); stats.CurrentStreak != 42 {
+		t.Errorf("statistics of today were recomputed: %+v", stats)
+	}
+
+	app.StatsCache["alice"] = StatsData{GeneratedAt: time.Now().AddDate(0, 0, -1).Unix(), CurrentStreak: 42}
+	if stats, _ := app.GetStats("alice"); stats.CurrentStreak != 1 {
+		t.Errorf("statistics of yesterday were not recomputed: %+v", stats)
+	}
+
+	app.InvalidateStats("alice")
+	if _, found := app.StatsCache["alice"]; found {
+		t.Error("invalidated statistics are still cached")
+	}
+	if _, found := app.GetStats("mallory"); found {
+		t.Error("statistics of an unknown user were returned")
+	}
+}
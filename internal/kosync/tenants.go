@@ -0,0 +1,206 @@
+//
+// File:        internal/kosync/tenants.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// TenantSeparator separates the tenant id and the username in the keys of Database.Users
+const TenantSeparator = "/"
+
+// UserKey returns the key of a user in Database.Users, users outside of tenants are stored by their username
+func UserKey(tenant, username string) string {
+	if len(tenant) == 0 {
+		return username
+	}
+	return tenant + TenantSeparator + username
+}
+
+// SplitUserKey returns the tenant and the username of a key in Database.Users.
+// Without tenants usernames may contain the TenantSeparator, Database.SplitUserKey tells such usernames apart.
+func SplitUserKey(key string) (tenant, username string) {
+	if tenant, username, found := strings.Cut(key, TenantSeparator); found {
+		return tenant, username
+	}
+	return "", key
+}
+
+// SplitUserKey returns the tenant and the username of a key, keys without a configured tenant are usernames
+func (db *Database) SplitUserKey(key string) (tenant, username string) {
+	tenant, username = SplitUserKey(key)
+	if _, found := db.FindTenant(tenant); !found {
+		return "", key
+	}
+	return tenant, username
+}
+
+// ValidateTenants checks that the tenants can be told apart
+func ValidateTenants(tenants []TenantData) error {
+	ids := make(map[string]bool)
+	hostnames := make(map[string]bool)
+	prefixes := make(map[string]bool)
+	for _, tenant := range tenants {
+		if len(tenant.Id) == 0 || strings.Contains(tenant.Id, TenantSeparator) {
+			return fmt.Errorf("tenant id '%s' must not be empty or contain '%s'", tenant.Id, TenantSeparator)
+		}
+		if ids[tenant.Id] {
+			return fmt.Errorf("tenant id '%s' is used more than once", tenant.Id)
+		}
+		ids[tenant.Id] = true
+
+		for _, hostname := range tenant.Hostnames {
+			hostname = strings.ToLower(hostname)
+			if hostnames[hostname] {
+				return fmt.Errorf("hostname '%s' of tenant '%s' is used more than once", hostname, tenant.Id)
+			}
+			hostnames[hostname] = true
+		}
+		if len(tenant.PathPrefix) > 0 {
+			if !strings.HasPrefix(tenant.PathPrefix, "/") || strings.HasSuffix(tenant.PathPrefix, "/") {
+				return fmt.Errorf("path prefix '%s' of tenant '%s' must start and must not end with '/'", tenant.PathPrefix, tenant.Id)
+			}
+			if prefixes[tenant.PathPrefix] {
+				return fmt.Errorf("path prefix '%s' of tenant '%s' is used more than once", tenant.PathPrefix, tenant.Id)
+			}
+			prefixes[tenant.PathPrefix] = true
+		}
+		if len(tenant.Hostnames) == 0 && len(tenant.PathPrefix) == 0 {
+			return fmt.Errorf("tenant '%s' needs hostnames or a path prefix", tenant.Id)
+		}
+	}
+	return nil
+}
+
+// FindTenant returns the tenant with the id
+func (db *Database) FindTenant(id string) (TenantData, bool) {
+	for _, tenant := range db.Config.Tenants {
+		if tenant.Id == id {
+			return tenant, true
+		}
+	}
+	return TenantData{}, false
+}
+
+// NewTenantMiddleware selects the tenant of a request by hostname or path prefix.
+// The path prefix is removed from the path, so the routes of the server match for all tenants.
+func (app *Kosync) NewTenantMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		hostname := c.Hostname()
+		path := c.Path()
+		app.LockDb()
+		tenants := app.Db.Config.Tenants
+		app.DbLock.Unlock()
+		for _, tenant := range tenants {
+			if slices.ContainsFunc(tenant.Hostnames, func(h string) bool { return strings.EqualFold(h, hostname) }) {
+				c.Locals("tenant", tenant.Id)
+				break
+			}
+			if len(tenant.PathPrefix) > 0 && (path == tenant.PathPrefix || strings.HasPrefix(path, tenant.PathPrefix+"/")) {
+				c.Locals("tenant", tenant.Id)
+				c.Locals("tenant_prefix", tenant.PathPrefix)
+				// The path is only valid during the request, so it is copied before being stored
+				c.Path(utils.CopyString("/" + strings.TrimPrefix(strings.TrimPrefix(path, tenant.PathPrefix), "/")))
+				break
+			}
+		}
+		return c.Next()
+	}
+}
+
+// CurrentTenant returns the id of the tenant of the request, empty outside of tenants
+func CurrentTenant(c *fiber.Ctx) string {
+	tenant, _ := c.Locals("tenant").(string)
+	return tenant
+}
+
+// TenantPathPrefix returns the path prefix the request was made with, links back to the server must start with it
+func TenantPathPrefix(c *fiber.Ctx) string {
+	prefix, _ := c.Locals("tenant_prefix").(string)
+	return prefix
+}
+
+// TenantsConfigured reports whether tenants are configured, only then usernames must not contain the TenantSeparator
+func (app *Kosync) TenantsConfigured() bool {
+	app.LockDb()
+	defer app.DbLock.Unlock()
+	return len(app.Db.Config.Tenants) > 0
+}
+
+// TenantUserCount returns the number of users of the tenant
+func (db *Database) TenantUserCount(tenant string) int {
+	count := 0
+	for _, user := range db.Users {
+		if user.Tenant == tenant {
+			count++
+		}
+	}
+	return count
+}
+
+// RequireTenantAdmin rejects requests of users that are not admins of their tenant and records all other requests in the audit log
+func (app *Kosync) RequireTenantAdmin(c *fiber.Ctx) error {
+	key, _ := c.Locals("current_user").(string)
+	app.LockDb()
+	user := app.Db.Users[key]
+	app.DbLock.Unlock()
+	// The handlers work on the tenant of the request, which must be the tenant of the admin
+	if len(user.Tenant) == 0 || user.Tenant != CurrentTenant(c) || !user.IsTenantAdmin {
+		app.RequestLogger(c, "Admin").Debug("Rejected request of non tenant admin user")
+		return fiber.ErrForbidden
+	}
+
+	app.Audit(c, AuditAdminAction, key, map[string]string{
+		"method": c.Method(),
+		"path":   c.Path(),
+		"tenant": user.Tenant,
+	})
+	return c.Next()
+}
+
+// ApiGetTenantUsers returns the accounts of all users of the tenant of the tenant admin
+func (app *Kosync) ApiGetTenantUsers(c *fiber.Ctx) error {
+	tenant := CurrentTenant(c)
+	app.LockDb()
+	accounts := make([]AccountData, 0)
+	for _, user := range app.Db.Users {
+		if user.Tenant == tenant {
+			accounts = append(accounts, accountOf(user))
+		}
+	}
+	app.DbLock.Unlock()
+
+	slices.SortFunc(accounts, func(a, b AccountData) int {
+		return strings.Compare(a.Username, b.Username)
+	})
+	return c.JSON(accounts)
+}
+
+// ApiDeleteTenantUser deletes the user of the username query parameter from the tenant of the tenant admin
+func (app *Kosync) ApiDeleteTenantUser(c *fiber.Ctx) error {
+	username := c.Query("username")
+	key := UserKey(CurrentTenant(c), username)
+	app.LockDb()
+	_, found := app.Db.Users[key]
+	app.DbLock.Unlock()
+	if len(username) == 0 || !found {
+		return fiber.ErrNotFound
+	}
+
+	pseudonym, err := app.DeleteUser(key)
+	if err != nil {
+		return err
+	}
+	app.RequestLogger(c, "Users").Info("Deleted user of tenant", "username", key)
+	app.Audit(c, AuditUserDeleted, pseudonym, map[string]string{"deleted_by": c.Locals("current_user").(string)})
+	return c.SendStatus(fiber.StatusNoContent)
+}
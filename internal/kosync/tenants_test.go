@@ -0,0 +1,210 @@
+//
+// File:        internal/kosync/tenants_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newTestTenantApp serves the tenant routes for alice and bob outside of tenants and carol, the admin, and dave in the tenant family
+func newTestTenantApp(t *testing.T) (*Kosync, *fiber.App) {
+	app := newTestApp(t)
+	app.Db.Config.Tenants = []TenantData{{Id: "family", PathPrefix: "/family"}}
+	addTestUser(app, "", "alice")
+	addTestUser(app, "", "bob")
+	addTestUser(app, "family", "carol")
+	addTestUser(app, "family", "dave")
+	carol := app.Db.Users["family/carol"]
+	carol.IsTenantAdmin = true
+	app.Db.Users["family/carol"] = carol
+
+	fiberApp := fiber.New()
+	fiberApp.Use(app.NewTenantMiddleware())
+	fiberApp.Use(app.NewAuthMiddleware())
+	fiberApp.Get("/api/me", app.ApiGetMe)
+	fiberApp.Get("/api/tenant.users", app.RequireTenantAdmin, app.ApiGetTenantUsers)
+	fiberApp.Delete("/api/tenant.users", app.RequireTenantAdmin, app.ApiDeleteTenantUser)
+	return app, fiberApp
+}
+
+func testTenantRequest(t *testing.T, fiberApp *fiber.App, method, path, username string) (int, []byte) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("x-auth-user", username)
+	req.Header.Set("x-auth-key", testUserKey)
+	resp, err := fiberApp.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	var body json.RawMessage
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func TestUsersOfTenantsOnlyLogInViaTheirTenant(t *testing.T) {
+	_, fiberApp := newTestTenantApp(t)
+	tests := []struct {
+		name     string
+		path     string
+		username string
+		status   int
+	}{
+		{"user outside of tenants", "/api/me", "alice", fiber.StatusOK},
+		{"user of the tenant", "/family/api/me", "carol", fiber.StatusOK},
+		{"tenant key outside of the tenant", "/api/me", "family/carol", fiber.StatusUnauthorized},
+		{"tenant key in the tenant", "/family/api/me", "family/carol", fiber.StatusUnauthorized},
+		{"user outside of tenants in a tenant", "/family/api/me", "alice", fiber.StatusUnauthorized},
+		{"tenant admin outside of the tenant", "/api/tenant.users", "family/carol", fiber.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status, body := testTenantRequest(t, fiberApp, fiber.MethodGet, test.path, test.username); status != test.status {
+				t.Errorf("status is %d with %s, expected %d", status, body, test.status)
+			}
+		})
+	}
+}
+
+func TestTenantAdminsOnlyManageTheirTenant(t *testing.T) {
+	app, fiberApp := newTestTenantApp(t)
+
+	status, body := testTenantRequest(t, fiberApp, fiber.MethodGet, "/family/api/tenant.users", "carol")
+	if status != fiber.StatusOK {
+		t.Fatalf("status is %d with %s", status, body)
+	}
+	var accounts []AccountData
+	if err := json.Unmarshal(body, &accounts); err != nil {
+		t.Fatal(err)
+	}
+	usernames := make([]string, 0)
+	for _, account := range accounts {
+		usernames = append(usernames, UserKey(account.Tenant, account.Username))
+	}
+	if !slices.Equal(usernames, []string{"family/carol", "family/dave"}) {
+		t.Errorf("tenant users are %v", usernames)
+	}
+
+	if status, _ := testTenantRequest(t, fiberApp, fiber.MethodGet, "/family/api/tenant.users", "dave"); status != fiber.StatusForbidden {
+		t.Errorf("user of the tenant got %d, expected 403", status)
+	}
+	if status, _ := testTenantRequest(t, fiberApp, fiber.MethodGet, "/api/tenant.users", "alice"); status != fiber.StatusForbidden {
+		t.Errorf("user outside of tenants got %d, expected 403", status)
+	}
+	if status, _ := testTenantRequest(t, fiberApp, fiber.MethodDelete, "/family/api/tenant.users?username=alice", "carol"); status != fiber.StatusNotFound {
+		t.Errorf("deleting a user outside of the tenant got %d, expected 404", status)
+	}
+	if _, found := app.Db.Users["alice"]; !found {
+		t.Error("the user outside of the tenant was deleted")
+	}
+	if status, _ := testTenantRequest(t, fiberApp, fiber.MethodDelete, "/family/api/tenant.users?username=dave", "carol"); status != fiber.StatusNoContent {
+		t.Errorf("deleting a user of the tenant got %d, expected 204", status)
+	}
+	if _, found := app.Db.Users["family/dave"]; found {
+		t.Error("the user of the tenant was not deleted")
+	}
+}
+
+func TestTenantAdminRightStaysWithTheUser(t *testing.T) {
+	app, fiberApp := newTestTenantApp(t)
+	if err := app.RenameUser("family/carol", "erin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RenameUser("family/dave", "carol"); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _ := testTenantRequest(t, fiberApp, fiber.MethodGet, "/family/api/tenant.users", "erin"); status != fiber.StatusOK {
+		t.Errorf("renamed admin got %d, expected 200", status)
+	}
+	if status, _ := testTenantRequest(t, fiberApp, fiber.MethodGet, "/family/api/tenant.users", "carol"); status != fiber.StatusForbidden {
+		t.Errorf("user with the previous name of the admin got %d, expected 403", status)
+	}
+}
+
+func TestTenantUserQuotaHoldsForParallelSignups(t *testing.T) {
+	app, fiberApp := newTestTenantApp(t)
+	app.Db.Config.Tenants[0].Quotas.MaxUsers = 5
+	fiberApp.Post("/users/create", app.UsersCreate)
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"username":"user%d","password":"%s"}`, i, testUserKey)
+			req := httptest.NewRequest(fiber.MethodPost, "/family/users/create", strings.NewReader(body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			resp, err := fiberApp.Test(req, -1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != fiber.StatusCreated && resp.StatusCode != fiber.StatusPaymentRequired {
+				t.Errorf("status is %d", resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if count := app.Db.TenantUserCount("family"); count != 5 {
+		t.Errorf("tenant has %d users, expected 5", count)
+	}
+}
+
+func TestUsernamesOnlyReserveTheSeparatorWithTenants(t *testing.T) {
+	signup := func(app *Kosync, username string) int {
+		fiberApp := fiber.New()
+		fiberApp.Use(app.NewTenantMiddleware())
+		fiberApp.Post("/users/create", app.UsersCreate)
+		body := fmt.Sprintf(`{"username":"%s","password":"%s"}`, username, testUserKey)
+		req := httptest.NewRequest(fiber.MethodPost, "/users/create", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, err := fiberApp.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := signup(newTestApp(t), "family/erin"); status != fiber.StatusCreated {
+		t.Errorf("signup without tenants got %d, expected 201", status)
+	}
+	app, _ := newTestTenantApp(t)
+	if status := signup(app, "family/erin"); status != fiber.StatusBadRequest {
+		t.Errorf("signup with tenants got %d, expected 400", status)
+	}
+}
+
+func TestImportKeepsUsernamesWithoutTenant(t *testing.T) {
+	app, _ := newTestTenantApp(t)
+	records := []ExportRecord{
+		{Type: ExportRecordUser, Username: "family/erin", Password: testUserKey},
+		{Type: ExportRecordUser, Username: "club/frank", Password: testUserKey},
+	}
+	ApplyImport(&app.Db, records)
+
+	if erin := app.Db.Users["family/erin"]; erin.Tenant != "family" || erin.Username != "erin" {
+		t.Errorf("user of the tenant is %+v", erin)
+	}
+	if frank := app.Db.Users["club/frank"]; frank.Tenant != "" || frank.Username != "club/frank" {
+		t.Errorf("user without tenant is %+v", frank)
+	}
+}
@@ -0,0 +1,205 @@
+//
+// File:        internal/kosync/tls.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Enabled reports whether the listen_address serves HTTPS
+func (config TlsData) Enabled() bool {
+	return len(config.CertFile) > 0 || len(config.Acme.Domains) > 0
+}
+
+// ValidateTls checks that the certificates come from exactly one source
+func ValidateTls(config TlsData) error {
+	if (len(config.CertFile) > 0) != (len(config.KeyFile) > 0) {
+		return errors.New("tls needs both cert_file and key_file")
+	}
+	if len(config.CertFile) > 0 && len(config.Acme.Domains) > 0 {
+		return errors.New("tls uses either cert_file and key_file or acme, not both")
+	}
+	for _, domain := range config.Acme.Domains {
+		if len(domain) == 0 {
+			return errors.New("acme domains must not be empty")
+		}
+	}
+	return nil
+}
+
+// Listen serves the app on the listen_address, with HTTPS when TLS is configured
+func (app *Kosync) Listen(fiberApp *fiber.App) error {
+	address := app.Db.Config.ListenAddress
+	config := app.Db.Config.Tls
+
+	var tlsConfig *tls.Config
+	switch {
+	case len(config.Acme.Domains) > 0:
+		manager, err := app.newAcmeManager()
+		if err != nil {
+			return err
+		}
+		tlsConfig = manager.TLSConfig()
+		// Fiber speaks HTTP/1.1 only, offering h2 would break clients that prefer it
+		tlsConfig.NextProtos = []string{"http/1.1", acme.ALPNProto}
+		if len(config.Acme.HttpListenAddress) > 0 {
+			go app.listenAcmeChallenges(manager, config.Acme.HttpListenAddress)
+		}
+	case len(config.CertFile) > 0:
+		reloader, err := newCertificateReloader(config.CertFile, config.KeyFile, app.Logger("Tls"))
+		if err != nil {
+			return err
+		}
+		tlsConfig = &tls.Config{GetCertificate: reloader.GetCertificate, NextProtos: []string{"http/1.1"}}
+	default:
+		return fiberApp.Listen(address)
+	}
+	tlsConfig.MinVersion = tls.VersionTLS12
+
+	listener, err := net.Listen(fiberApp.Config().Network, address)
+	if err != nil {
+		return err
+	}
+	app.Logger("Tls").Info("Serving HTTPS", "address", address)
+	return fiberApp.Listener(tls.NewListener(listener, tlsConfig))
+}
+
+// AcmeCacheDirectory returns the directory of the ACME account and certificates, relative paths are relative to the database file
+func (app *Kosync) AcmeCacheDirectory() string {
+	dir := app.Db.Config.Tls.Acme.CacheDirectory
+	if len(dir) == 0 {
+		return filepath.Join(filepath.Dir(app.DbFile), "acme")
+	}
+	if !filepath.IsAbs(dir) {
+		return filepath.Join(filepath.Dir(app.DbFile), dir)
+	}
+	return dir
+}
+
+func (app *Kosync) newAcmeManager() (*autocert.Manager, error) {
+	config := app.Db.Config.Tls.Acme
+
+	// An empty DirectoryURL is Let's Encrypt
+	client := &acme.Client{DirectoryURL: config.DirectoryUrl}
+	if len(config.CaFile) > 0 {
+		data, err := os.ReadFile(config.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("ca_file '%s' contains no certificates", config.CaFile)
+		}
+		client.HTTPClient = &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+		}}
+	}
+
+	allowed := autocert.HostWhitelist(config.Domains...)
+	return &autocert.Manager{
+		Prompt: autocert.AcceptTOS,
+		Cache:  autocert.DirCache(app.AcmeCacheDirectory()),
+		// HTTP-01 challenges pass the Host header, which contains the port when the CA does not use port 80
+		HostPolicy: func(ctx context.Context, host string) error {
+			if hostname, _, err := net.SplitHostPort(host); err == nil {
+				host = hostname
+			}
+			return allowed(ctx, host)
+		},
+		Client: client,
+		Email:  config.Email,
+	}, nil
+}
+
+// listenAcmeChallenges answers HTTP-01 challenges and redirects all other requests to HTTPS
+func (app *Kosync) listenAcmeChallenges(manager *autocert.Manager, address string) {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           manager.HTTPHandler(nil),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	app.Logger("Tls").Info("Serving ACME challenges", "address", address)
+	if err := server.ListenAndServe(); err != nil {
+		app.Logger("Tls").Error("Failed to serve ACME challenges", "error", err)
+	}
+}
+
+// certificateReloader serves the certificate of cert_file and key_file and reloads it when one of the files changes,
+// so renewed certificates are used without a restart
+type certificateReloader struct {
+	certFile    string
+	keyFile     string
+	logger      *slog.Logger
+	lock        sync.Mutex
+	certificate *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+func newCertificateReloader(certFile, keyFile string, logger *slog.Logger) (*certificateReloader, error) {
+	reloader := &certificateReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if _, err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// reload loads the files when their modification time changed and reports whether it did, the caller holds the lock
+func (reloader *certificateReloader) reload() (bool, error) {
+	certStat, err := os.Stat(reloader.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyStat, err := os.Stat(reloader.keyFile)
+	if err != nil {
+		return false, err
+	}
+	if certStat.ModTime().Equal(reloader.certModTime) && keyStat.ModTime().Equal(reloader.keyModTime) {
+		return false, nil
+	}
+
+	// Failed loads are only retried after the next change, a half written file is not reported on every handshake
+	reloader.certModTime = certStat.ModTime()
+	reloader.keyModTime = keyStat.ModTime()
+	certificate, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return false, err
+	}
+	reloader.certificate = &certificate
+	return true, nil
+}
+
+// GetCertificate keeps serving the previous certificate when the files can not be loaded
+func (reloader *certificateReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.lock.Lock()
+	defer reloader.lock.Unlock()
+
+	reloaded, err := reloader.reload()
+	if err != nil {
+		reloader.logger.Error("Failed to reload the certificate, serving the previous one", "file", reloader.certFile, "error", err)
+	} else if reloaded {
+		reloader.logger.Info("Reloaded the certificate", "file", reloader.certFile)
+	}
+	return reloader.certificate, nil
+}
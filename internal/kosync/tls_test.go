@@ -0,0 +1,473 @@
+//
+// File:        internal/kosync/tls_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/acme"
+)
+
+// writeTestCertificate writes a new self-signed certificate for the common name and sets the modification time of both files
+func writeTestCertificate(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	touchTestFiles(t, modTime, certFile, keyFile)
+}
+
+// touchTestFiles sets the modification time, writes within the resolution of the file system would not be noticed otherwise
+func touchTestFiles(t *testing.T, modTime time.Time, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// servedCommonName completes a handshake with the reloader and returns the common name of the certificate the client received
+func servedCommonName(t *testing.T, reloader *certificateReloader) string {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	defer func() {
+		_ = clientConn.Close()
+	}()
+	go func() {
+		server := tls.Server(serverConn, &tls.Config{GetCertificate: reloader.GetCertificate, MinVersion: tls.VersionTLS12})
+		_ = server.Handshake()
+		_ = server.Close()
+	}()
+
+	client := tls.Client(clientConn, &tls.Config{ServerName: "kosync.test", InsecureSkipVerify: true, MinVersion: tls.VersionTLS12})
+	if err := client.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	return client.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func TestCertificateReloaderSwapsChangedCertificates(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Hour)
+	writeTestCertificate(t, certFile, keyFile, "first", start)
+
+	reloader, err := newCertificateReloader(certFile, keyFile, (&Kosync{}).Logger("Tls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := servedCommonName(t, reloader); name != "first" {
+		t.Fatalf("served %q, expected the first certificate", name)
+	}
+
+	// Renewed files are served from the next handshake on
+	writeTestCertificate(t, certFile, keyFile, "renewed", start.Add(time.Minute))
+	if name := servedCommonName(t, reloader); name != "renewed" {
+		t.Errorf("served %q after the renewal, expected the renewed certificate", name)
+	}
+
+	// While only the certificate was replaced, it does not match the key and the previous certificate stays
+	renewedKey, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestCertificate(t, certFile, keyFile, "half", start.Add(2*time.Minute))
+	if err := os.WriteFile(keyFile, renewedKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+	touchTestFiles(t, start.Add(2*time.Minute), keyFile)
+	if name := servedCommonName(t, reloader); name != "renewed" {
+		t.Errorf("served %q while the files did not match, expected the previous certificate", name)
+	}
+
+	// Replacing the key as well completes the renewal
+	writeTestCertificate(t, certFile, keyFile, "second", start.Add(3*time.Minute))
+	if name := servedCommonName(t, reloader); name != "second" {
+		t.Errorf("served %q after the second renewal, expected the second certificate", name)
+	}
+}
+
+func TestCertificateReloaderKeepsCertificateOfUnchangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	modTime := time.Now().Add(-time.Hour)
+	writeTestCertificate(t, certFile, keyFile, "first", modTime)
+
+	reloader, err := newCertificateReloader(certFile, keyFile, (&Kosync{}).Logger("Tls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files with the same modification time are not read again
+	writeTestCertificate(t, certFile, keyFile, "unnoticed", modTime)
+	again, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != first || !bytes.Equal(again.Certificate[0], first.Certificate[0]) {
+		t.Error("the certificate was reloaded without a change of the modification time")
+	}
+}
+
+func TestNewCertificateReloaderRejectsInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if _, err := newCertificateReloader(certFile, keyFile, (&Kosync{}).Logger("Tls")); err == nil {
+		t.Error("missing files were accepted")
+	}
+
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newCertificateReloader(certFile, keyFile, (&Kosync{}).Logger("Tls")); err == nil {
+		t.Error("invalid files were accepted")
+	}
+}
+
+// testAcmeServer is a minimal ACME CA after RFC 8555 for one domain. It validates TLS-ALPN-01 challenges against
+// the address of the domain and issues certificates signed by its own CA, JWS signatures are not checked.
+type testAcmeServer struct {
+	*httptest.Server
+	t          *testing.T
+	domain     string
+	address    string // Address TLS-ALPN-01 challenges are validated against
+	caKey      *ecdsa.PrivateKey
+	ca         *x509.Certificate
+	lock       sync.Mutex
+	nonce      int
+	thumbprint string // Of the account key
+	status     string // Of the authorization
+	chain      []byte
+}
+
+func newTestAcmeServer(t *testing.T, domain, address string) *testAcmeServer {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "KOsync Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &testAcmeServer{t: t, domain: domain, address: address, caKey: caKey, ca: ca, status: acme.StatusPending}
+	server.Server = httptest.NewTLSServer(http.HandlerFunc(server.serveHTTP))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (server *testAcmeServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.nonce++
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", server.nonce))
+	if r.URL.Path == "/directory" {
+		server.writeJson(w, http.StatusOK, map[string]string{
+			"newNonce":   server.URL + "/nonce",
+			"newAccount": server.URL + "/account",
+			"newOrder":   server.URL + "/order",
+			"revokeCert": server.URL + "/revoke",
+			"keyChange":  server.URL + "/key-change",
+		})
+		return
+	}
+	if r.URL.Path == "/nonce" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	protected, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+
+	switch r.URL.Path {
+	case "/account":
+		var header struct {
+			Jwk struct {
+				Crv string `json:"crv"`
+				Kty string `json:"kty"`
+				X   string `json:"x"`
+				Y   string `json:"y"`
+			} `json:"jwk"`
+		}
+		if err := json.Unmarshal(protected, &header); err != nil || header.Jwk.Kty != "EC" {
+			http.Error(w, "expected an EC account key", http.StatusBadRequest)
+			return
+		}
+		// RFC 7638 thumbprint of the members of the key in lexicographic order
+		jwk := fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s","y":"%s"}`, header.Jwk.Crv, header.Jwk.Kty, header.Jwk.X, header.Jwk.Y)
+		sum := sha256.Sum256([]byte(jwk))
+		server.thumbprint = base64.RawURLEncoding.EncodeToString(sum[:])
+		w.Header().Set("Location", server.URL+"/account/1")
+		server.writeJson(w, http.StatusCreated, map[string]string{"status": acme.StatusValid})
+	case "/order":
+		w.Header().Set("Location", server.URL+"/order/1")
+		server.writeJson(w, http.StatusCreated, server.order())
+	case "/order/1":
+		w.Header().Set("Location", server.URL+"/order/1")
+		server.writeJson(w, http.StatusOK, server.order())
+	case "/authz/1":
+		server.writeJson(w, http.StatusOK, server.authorization())
+	case "/challenge/1":
+		// The server may request a certificate from here during the validation
+		server.lock.Unlock()
+		err := server.validate()
+		server.lock.Lock()
+		if err != nil {
+			server.t.Logf("TLS-ALPN-01 validation failed: %v", err)
+			server.status = acme.StatusInvalid
+		} else {
+			server.status = acme.StatusValid
+		}
+		server.writeJson(w, http.StatusOK, server.authorization()["challenges"].([]map[string]string)[0])
+	case "/finalize/1":
+		var request struct {
+			Csr string `json:"csr"`
+		}
+		if err := json.Unmarshal(payload, &request); err != nil || server.status != acme.StatusValid {
+			http.Error(w, "order is not ready", http.StatusForbidden)
+			return
+		}
+		if err := server.issue(request.Csr); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Location", server.URL+"/order/1")
+		server.writeJson(w, http.StatusOK, server.order())
+	case "/certificate/1":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_, _ = w.Write(server.chain)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (server *testAcmeServer) writeJson(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (server *testAcmeServer) order() map[string]any {
+	order := map[string]any{
+		"status":         acme.StatusPending,
+		"identifiers":    []map[string]string{{"type": "dns", "value": server.domain}},
+		"authorizations": []string{server.URL + "/authz/1"},
+		"finalize":       server.URL + "/finalize/1",
+	}
+	if server.status == acme.StatusValid {
+		order["status"] = acme.StatusReady
+	}
+	if len(server.chain) > 0 {
+		order["status"] = acme.StatusValid
+		order["certificate"] = server.URL + "/certificate/1"
+	}
+	return order
+}
+
+func (server *testAcmeServer) authorization() map[string]any {
+	return map[string]any{
+		"status":     server.status,
+		"identifier": map[string]string{"type": "dns", "value": server.domain},
+		"challenges": []map[string]string{{"type": "tls-alpn-01", "url": server.URL + "/challenge/1", "token": "token-1", "status": server.status}},
+	}
+}
+
+// validate connects to the address of the domain like a CA and checks the key authorization of the challenge certificate
+func (server *testAcmeServer) validate() error {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", server.address, &tls.Config{
+		ServerName:         server.domain,
+		NextProtos:         []string{acme.ALPNProto},
+		InsecureSkipVerify: true, // The challenge certificate is self-signed
+		MinVersion:         tls.VersionTLS12,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if protocol := conn.ConnectionState().NegotiatedProtocol; protocol != acme.ALPNProto {
+		return fmt.Errorf("negotiated protocol %q", protocol)
+	}
+
+	keyAuthorization := sha256.Sum256([]byte("token-1." + server.thumbprint))
+	for _, extension := range conn.ConnectionState().PeerCertificates[0].Extensions {
+		if !extension.Id.Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}) {
+			continue
+		}
+		var digest []byte
+		if _, err := asn1.Unmarshal(extension.Value, &digest); err != nil {
+			return err
+		}
+		if !bytes.Equal(digest, keyAuthorization[:]) {
+			return errors.New("wrong key authorization")
+		}
+		return nil
+	}
+	return errors.New("the certificate has no acmeIdentifier extension")
+}
+
+func (server *testAcmeServer) issue(encodedCsr string) error {
+	der, err := base64.RawURLEncoding.DecodeString(encodedCsr)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(csr.DNSNames, []string{server.domain}) {
+		return fmt.Errorf("csr for %v", csr.DNSNames)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: server.domain},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, server.ca, csr.PublicKey, server.caKey)
+	if err != nil {
+		return err
+	}
+	server.chain = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.ca.Raw})...)
+	return nil
+}
+
+func TestListenObtainsAcmeCertificates(t *testing.T) {
+	const domain = "kosync.test"
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	acmeServer := newTestAcmeServer(t, domain, address)
+	app := newTestApp(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: acmeServer.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	app.Db.Config.ListenAddress = address
+	app.Db.Config.Tls.Acme = AcmeData{Domains: []string{domain}, DirectoryUrl: acmeServer.URL + "/directory", CaFile: caFile}
+
+	fiberApp := fiber.New(fiber.Config{DisableStartupMessage: true})
+	fiberApp.Get("/healthz", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	go func() {
+		if err := app.Listen(fiberApp); err != nil {
+			t.Error(err)
+		}
+	}()
+	defer func() {
+		// Handshakes of failed certificate requests can keep connections open
+		_ = fiberApp.ShutdownWithTimeout(time.Second)
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(acmeServer.ca)
+	client := &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: domain, MinVersion: tls.VersionTLS12},
+	}}
+	var resp *http.Response
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if resp, err = client.Get("https://" + address + "/healthz"); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS.PeerCertificates[0].Issuer.CommonName != "KOsync Test CA" {
+		t.Errorf("got %d with a certificate of %q", resp.StatusCode, resp.TLS.PeerCertificates[0].Issuer.CommonName)
+	}
+	if _, err := os.Stat(filepath.Join(app.AcmeCacheDirectory(), domain)); err != nil {
+		t.Errorf("the certificate is not cached: %v", err)
+	}
+}
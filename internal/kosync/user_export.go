@@ -0,0 +1,102 @@
+//
+// File:        internal/kosync/user_export.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	UserExportFormatJson = "json"
+	UserExportFormatZip  = "zip"
+)
+
+// UserExportData contains everything KOsync stores about a user
+type UserExportData struct {
+	ExportedAt        int64                 `json:"exported_at"`
+	User              UserData              `json:"user"`
+	Devices           []StatsDeviceData     `json:"devices"`
+	Audit             []AuditEntry          `json:"audit"`
+	WebhookDeliveries []WebhookDeliveryData `json:"webhook_deliveries"`
+}
+
+// ExportUser collects the account, documents, history, devices, audit entries and webhook deliveries of a user
+func (app *Kosync) ExportUser(username string) (UserExportData, error) {
+	app.LockDb()
+	user, found := app.Db.Users[username]
+	if !found {
+		app.DbLock.Unlock()
+		return UserExportData{}, fmt.Errorf("user '%s' does not exist", username)
+	}
+	now := time.Now()
+	devices := ComputeStats(user, now).Devices
+	data, err := json.Marshal(user)
+	app.DbLock.Unlock()
+	if err != nil {
+		return UserExportData{}, err
+	}
+
+	// The maps of the user are shared with the database, the export works on a copy
+	export := UserExportData{ExportedAt: now.Unix(), Devices: devices}
+	if err := json.Unmarshal(data, &export.User); err != nil {
+		return UserExportData{}, err
+	}
+	export.Audit, err = app.QueryAudit(AuditQuery{Username: username})
+	if err != nil {
+		return UserExportData{}, err
+	}
+	export.WebhookDeliveries, err = app.ReadWebhookDeliveries(username, 0)
+	if err != nil {
+		return UserExportData{}, err
+	}
+	return export, nil
+}
+
+// WriteUserExportZip writes the export as zip archive with one JSON file per section
+func WriteUserExportZip(w io.Writer, export UserExportData) error {
+	archive := zip.NewWriter(w)
+	account := struct {
+		Username   string        `json:"username"`
+		Password   string        `json:"password"`
+		IsAdmin    bool          `json:"is_admin"`
+		Webhooks   []WebhookData `json:"webhooks"`
+		ExportedAt int64         `json:"exported_at"`
+	}{export.User.Username, export.User.Password, export.User.IsAdmin, export.User.Webhooks, export.ExportedAt}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"account.json", account},
+		{"documents.json", export.User.Documents},
+		{"history.json", export.User.History},
+		{"aliases.json", export.User.Aliases},
+		{"devices.json", export.Devices},
+		{"audit.json", export.Audit},
+		{"webhook_deliveries.json", export.WebhookDeliveries},
+	}
+	for _, file := range files {
+		fw, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: time.Unix(export.ExportedAt, 0),
+		})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(fw)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
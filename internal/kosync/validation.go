@@ -0,0 +1,44 @@
+//
+// File:        internal/kosync/validation.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+)
+
+// documentHashPattern matches the MD5 hashes KOReader uses as document ids, both for the file content and the file name
+var documentHashPattern = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+
+// Validate rejects progress pushes that KOReader would never send.
+// The device_id is optional, like on the KOReader sync server.
+func (data DocumentData) Validate() error {
+	if err := data.validateStored(); err != nil {
+		return err
+	}
+	if len(data.Progress) == 0 {
+		return fmt.Errorf("progress must not be empty")
+	}
+	if len(data.Device) == 0 {
+		return fmt.Errorf("device must not be empty")
+	}
+	return nil
+}
+
+// validateStored checks the document id and the percentage, which are valid for every stored document.
+// Imports use it instead of Validate, data stored before the validation may have empty fields.
+func (data DocumentData) validateStored() error {
+	if !documentHashPattern.MatchString(data.Document) {
+		return fmt.Errorf("document must be a MD5 hash of 32 hexadecimal characters")
+	}
+	percentage := float64(data.Percentage)
+	if math.IsNaN(percentage) || percentage < 0 || percentage > 1 {
+		return fmt.Errorf("percentage must be a number between 0 and 1")
+	}
+	return nil
+}
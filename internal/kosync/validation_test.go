@@ -0,0 +1,55 @@
+//
+// File:        internal/kosync/validation_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDocumentDataValidate(t *testing.T) {
+	valid := DocumentData{
+		ProgressData: ProgressData{Percentage: 0.5, Progress: "/body/DocFragment[1]/body/p[1]", Device: "Kobo", DeviceId: "ID1"},
+		Document:     "0123456789abcdef0123456789ABCDEF",
+	}
+	tests := []struct {
+		name   string
+		change func(data *DocumentData)
+		valid  bool
+	}{
+		{"valid", func(data *DocumentData) {}, true},
+		{"start of the document", func(data *DocumentData) { data.Percentage = 0 }, true},
+		{"end of the document", func(data *DocumentData) { data.Percentage = 1 }, true},
+		{"empty hash", func(data *DocumentData) { data.Document = "" }, false},
+		{"short hash", func(data *DocumentData) { data.Document = "0123456789abcdef" }, false},
+		{"long hash", func(data *DocumentData) { data.Document += "0" }, false},
+		{"non-hex hash", func(data *DocumentData) { data.Document = "0123456789abcdef0123456789abcdeg" }, false},
+		{"hash with path", func(data *DocumentData) { data.Document = "../../0123456789abcdef0123456789" }, false},
+		{"hash with newline", func(data *DocumentData) { data.Document = "0123456789abcdef0123456789abcdef\n" }, false},
+		{"NaN", func(data *DocumentData) { data.Percentage = float32(math.NaN()) }, false},
+		{"infinity", func(data *DocumentData) { data.Percentage = float32(math.Inf(1)) }, false},
+		{"below 0", func(data *DocumentData) { data.Percentage = -0.01 }, false},
+		{"above 1", func(data *DocumentData) { data.Percentage = 1.01 }, false},
+		{"empty progress", func(data *DocumentData) { data.Progress = "" }, false},
+		{"empty device", func(data *DocumentData) { data.Device = "" }, false},
+		{"without device id", func(data *DocumentData) { data.DeviceId = "" }, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := valid
+			test.change(&data)
+			err := data.Validate()
+			if test.valid && err != nil {
+				t.Errorf("valid data was rejected: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("invalid data was accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+//
+// File:        internal/kosync/webhooks.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+)
+
+const (
+	WebhookEventProgress       = "progress.updated"
+	WebhookEventFinished       = "document.finished"
+	WebhookEventUserCreated    = "user.created"
+	WebhookEventBackupCreated  = "backup.created"
+	WebhookDeliveryLogFile     = "webhook_deliveries.log"
+	WebhookDeliveryLogMaxSize  = 1 << 20 // Beyond this size the delivery log is rotated, the deliveries of the previous rotation are dropped
+	WebhookMaxAttempts         = 5
+	WebhookInitialRetryBackoff = 2 * time.Second
+)
+
+var WebhookEvents = []string{WebhookEventProgress, WebhookEventFinished, WebhookEventUserCreated, WebhookEventBackupCreated}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// userWebhookClient only connects to public addresses, so users can not reach the network of the server.
+// The address is checked after resolving, which covers redirects and hostnames resolving to internal addresses.
+var userWebhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: 10 * time.Second, Control: dialPublicOnly}).DialContext,
+	},
+}
+
+// dialPublicOnly rejects connections to loopback, private, link-local and other non-public addresses
+func dialPublicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !IsPublicAddress(ip) {
+		return fmt.Errorf("webhook target %s is not a public address", ip)
+	}
+	return nil
+}
+
+// sharedAddressSpace is used by carrier-grade NAT and not reachable from the internet
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func IsPublicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+type WebhookPayload struct {
+	Id        string `json:"id"`
+	Event     string `json:"event"`
+	Timestamp int64  `json:"timestamp"`
+	Username  string `json:"username,omitempty"`
+	Data      any    `json:"data"`
+}
+
+type WebhookDeliveryData struct {
+	Id        string `json:"id"`
+	Event     string `json:"event"`
+	Url       string `json:"url"`
+	Username  string `json:"username,omitempty"` // Owner of the webhook, empty for global webhooks
+	Attempt   int    `json:"attempt"`
+	Status    int    `json:"status"`
+	Error     string `json:"error,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// FireWebhooks delivers the event to all matching global webhooks and the webhooks of the user in the background.
+// Must be called while holding the DbLock, the webhooks are copied before returning.
+func (app *Kosync) FireWebhooks(username, event string, data any) {
+	type target struct {
+		owner   string
+		webhook WebhookData
+	}
+	targets := make([]target, 0)
+	for _, webhook := range app.Db.Config.Webhooks {
+		targets = append(targets, target{"", webhook})
+	}
+	if len(username) > 0 {
+		for _, webhook := range app.Db.Users[username].Webhooks {
+			targets = append(targets, target{username, webhook})
+		}
+	}
+
+	for _, t := range targets {
+		if len(t.webhook.Events) > 0 && !slices.Contains(t.webhook.Events, event) {
+			continue
+		}
+		payload := WebhookPayload{
+			Id:        newWebhookId(),
+			Event:     event,
+			Timestamp: time.Now().Unix(),
+			Username:  username,
+			Data:      data,
+		}
+		go app.deliverWebhook(t.owner, t.webhook, payload)
+	}
+}
+
+func (app *Kosync) deliverWebhook(owner string, webhook WebhookData, payload WebhookPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		app.Logger("Webhooks").Error("Failed to marshal payload", "event", payload.Event, "error", err)
+		return
+	}
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	// Global webhooks are configured by the operator and may target the internal network
+	client := webhookClient
+	if len(owner) > 0 {
+		client = userWebhookClient
+	}
+
+	backoff := WebhookInitialRetryBackoff
+	for attempt := 1; attempt <= WebhookMaxAttempts; attempt++ {
+		delivery := WebhookDeliveryData{
+			Id:        payload.Id,
+			Event:     payload.Event,
+			Url:       webhook.Url,
+			Username:  owner,
+			Attempt:   attempt,
+			Timestamp: time.Now().Unix(),
+		}
+
+		status, err := postWebhook(client, webhook.Url, signature, payload, body)
+		delivery.Status = status
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		app.logWebhookDelivery(delivery)
+
+		if err == nil {
+			app.Logger("Webhooks").Debug("Delivered event", "event", payload.Event, "url", webhook.Url)
+			return
+		}
+		app.Logger("Webhooks").Debug("Delivery failed", "event", payload.Event, "url", webhook.Url, "attempt", attempt, "max_attempts", WebhookMaxAttempts, "error", err)
+		if attempt < WebhookMaxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	app.Logger("Webhooks").Error("Giving up delivering event", "event", payload.Event, "url", webhook.Url)
+}
+
+func postWebhook(client *http.Client, url, signature string, payload WebhookPayload, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("KOsync/%s", Version))
+	req.Header.Set("X-Kosync-Event", payload.Event)
+	req.Header.Set("X-Kosync-Delivery", payload.Id)
+	req.Header.Set("X-Kosync-Signature", signature)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookDeliveryLogFiles returns the delivery log next to the database and its rotated predecessor, newest first
+func (app *Kosync) webhookDeliveryLogFiles() []string {
+	path := filepath.Join(filepath.Dir(app.DbFile), WebhookDeliveryLogFile)
+	return []string{path, path + ".1"}
+}
+
+// logWebhookDelivery appends the delivery attempt as JSON line to the delivery log and rotates the log once it is too large
+func (app *Kosync) logWebhookDelivery(delivery WebhookDeliveryData) {
+	app.WebhookLock.Lock()
+	defer app.WebhookLock.Unlock()
+
+	files := app.webhookDeliveryLogFiles()
+	if err := appendJsonLine(files[0], delivery); err != nil {
+		app.Logger("Webhooks").Error("Failed to write delivery log", "error", err)
+		return
+	}
+	if info, err := os.Stat(files[0]); err == nil && info.Size() >= WebhookDeliveryLogMaxSize {
+		if err := os.Rename(files[0], files[1]); err != nil {
+			app.Logger("Webhooks").Error("Failed to rotate delivery log", "error", err)
+		}
+	}
+}
+
+// ReadWebhookDeliveries returns the latest deliveries of the webhooks owned by the user, newest first. A limit of 0 returns all deliveries.
+// The rotated log is only read when the current one has fewer deliveries than the limit.
+func (app *Kosync) ReadWebhookDeliveries(username string, limit int) ([]WebhookDeliveryData, error) {
+	app.WebhookLock.Lock()
+	defer app.WebhookLock.Unlock()
+
+	result := make([]WebhookDeliveryData, 0)
+	for _, path := range app.webhookDeliveryLogFiles() {
+		deliveries := make([]WebhookDeliveryData, 0)
+		err := readJsonLines(path, func(line []byte) error {
+			var delivery WebhookDeliveryData
+			if err := json.Unmarshal(line, &delivery); err != nil {
+				return err
+			}
+			if delivery.Username == username {
+				deliveries = append(deliveries, delivery)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		slices.Reverse(deliveries)
+		result = append(result, deliveries...)
+
+		if limit > 0 && len(result) >= limit {
+			return result[:limit], nil
+		}
+	}
+	return result, nil
+}
+
+func newWebhookId() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func appendJsonLine(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReplaceWebhookDeliveryUsername moves the logged deliveries of the user to a new username, an empty replacement removes them
+func (app *Kosync) ReplaceWebhookDeliveryUsername(username, replacement string) error {
+	app.WebhookLock.Lock()
+	defer app.WebhookLock.Unlock()
+
+	for _, path := range app.webhookDeliveryLogFiles() {
+		err := rewriteJsonLines(path, func(line []byte) ([]byte, error) {
+			var delivery WebhookDeliveryData
+			if err := json.Unmarshal(line, &delivery); err != nil {
+				return nil, err
+			}
+			if delivery.Username != username {
+				return line, nil
+			}
+			if len(replacement) == 0 {
+				return nil, nil
+			}
+			delivery.Username = replacement
+			return json.Marshal(delivery)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readJsonLines calls fn for every non-empty line of the file, a missing file has no lines
+func readJsonLines(path string, fn func(line []byte) error) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteJsonLines replaces every non-empty line of the file with the result of fn, nil removes the line.
+// The file is replaced as a whole, so a failed rewrite keeps the previous lines.
+func rewriteJsonLines(path string, fn func(line []byte) ([]byte, error)) error {
+	var result bytes.Buffer
+	err := readJsonLines(path, func(line []byte) error {
+		replaced, err := fn(line)
+		if err != nil {
+			return err
+		}
+		if replaced != nil {
+			result.Write(replaced)
+			result.WriteByte('\n')
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(result.Bytes()); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,76 @@
+//
+// File:        internal/kosync/webhooks_test.go
+// Project:     https://git.obth.eu/atjontv/kosync
+// Copyright:   © 2025-2026 Thomas Obernosterer. Licensed under the EUPL-1.2 or later
+//
+
+package kosync
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestWebhookDeliveryLogRotation(t *testing.T) {
+	app := newTestApp(t)
+	files := app.webhookDeliveryLogFiles()
+	logged := 0
+	logDelivery := func(username string) {
+		app.logWebhookDelivery(WebhookDeliveryData{Id: strconv.Itoa(logged), Event: WebhookEventProgress, Url: "https://example.com/hook", Username: username})
+		logged++
+	}
+
+	// Fill the log until it is rotated, every other delivery belongs to alice
+	for {
+		logDelivery("alice")
+		logDelivery("bob")
+		if _, err := os.Stat(files[1]); err == nil {
+			break
+		}
+		if logged > 2*WebhookDeliveryLogMaxSize/100 {
+			t.Fatal("the delivery log was not rotated")
+		}
+	}
+	if info, err := os.Stat(files[1]); err != nil || info.Size() > WebhookDeliveryLogMaxSize+1024 {
+		t.Fatalf("rotated log is %v (%v)", info, err)
+	}
+	aliceDeliveries := logged / 2
+	logDelivery("alice")
+	logDelivery("alice")
+	aliceDeliveries += 2
+
+	// The two newest deliveries are in the current log, further ones come from the rotated log
+	for _, limit := range []int{2, 10} {
+		deliveries, err := app.ReadWebhookDeliveries("alice", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) != limit || deliveries[0].Id != strconv.Itoa(logged-1) {
+			t.Fatalf("read %d deliveries starting with %+v", len(deliveries), deliveries[0])
+		}
+		for i := 1; i < len(deliveries); i++ {
+			previous, _ := strconv.Atoi(deliveries[i-1].Id)
+			if current, _ := strconv.Atoi(deliveries[i].Id); current >= previous || deliveries[i].Username != "alice" {
+				t.Errorf("delivery %d is %+v after %+v", i, deliveries[i], deliveries[i-1])
+			}
+		}
+	}
+	if deliveries, err := app.ReadWebhookDeliveries("alice", 0); err != nil || len(deliveries) != aliceDeliveries {
+		t.Errorf("read %d of %d deliveries of alice: %v", len(deliveries), aliceDeliveries, err)
+	}
+
+	// Renames and deletions reach the rotated log as well
+	if err := app.ReplaceWebhookDeliveryUsername("alice", "carol"); err != nil {
+		t.Fatal(err)
+	}
+	if deliveries, err := app.ReadWebhookDeliveries("carol", 0); err != nil || len(deliveries) != aliceDeliveries {
+		t.Errorf("read %d of %d deliveries of carol: %v", len(deliveries), aliceDeliveries, err)
+	}
+	if err := app.ReplaceWebhookDeliveryUsername("bob", ""); err != nil {
+		t.Fatal(err)
+	}
+	if deliveries, err := app.ReadWebhookDeliveries("bob", 0); err != nil || len(deliveries) != 0 {
+		t.Errorf("%d deliveries of bob were kept: %v", len(deliveries), err)
+	}
+}
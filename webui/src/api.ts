@@ -3,6 +3,9 @@ import {useUserStore} from "@/stores/user.ts";
 // NOTE: Only set this to a KOsync Server when using vite dev
 const BASE_URL = "";
 
+// Path prefix of the tenant when the WebUI is opened below one, like /family/web
+export const PATH_PREFIX = location.pathname.substring(0, location.pathname.indexOf(import.meta.env.BASE_URL.replace(/\/$/, "")));
+
 export async function fetchApi<T>(route: string, options: RequestInit): Promise<{data: T | null, error: string | Response | null}> {
     const userStore = useUserStore();
     if (!userStore.user.username || !userStore.user.key) {
@@ -10,7 +13,7 @@ export async function fetchApi<T>(route: string, options: RequestInit): Promise<
     }
 
     const response = await fetch(
-      `${BASE_URL}${route}`,
+      `${BASE_URL}${PATH_PREFIX}${route}`,
       {
         ...options,
         headers: {...options.headers, 'x-auth-user': userStore.user.username, 'x-auth-key': userStore.user.key}
@@ -28,7 +31,7 @@ export async function fetchApi<T>(route: string, options: RequestInit): Promise<
 
 export async function fetchUrl<T>(route: string, options: RequestInit): Promise<{data: T | null, error: string | Response | null}> {
   const response = await fetch(
-    `${BASE_URL}${route}`,
+    `${BASE_URL}${PATH_PREFIX}${route}`,
     options
   );
   if (!response.ok) return Promise.reject({data: null, error: response});
@@ -40,3 +43,38 @@ export async function fetchUrl<T>(route: string, options: RequestInit): Promise<
     return Promise.resolve({data: await response.text() as T, error: null});
   }
 }
+
+export async function streamApi(route: string, onEvent: (type: string, data: string) => void, signal?: AbortSignal): Promise<void> {
+    const userStore = useUserStore();
+    if (!userStore.user.username || !userStore.user.key) return;
+
+    // EventSource can not send the auth headers, so the stream is read via fetch
+    const response = await fetch(
+      `${BASE_URL}${PATH_PREFIX}${route}`,
+      {
+        signal,
+        headers: {'x-auth-user': userStore.user.username, 'x-auth-key': userStore.user.key}
+      }
+    );
+    if (!response.ok || response.body === null) return Promise.reject({data: null, error: response.statusText});
+
+    const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+    let buffer = "";
+    while (true) {
+        const {value, done} = await reader.read();
+        if (done) return;
+
+        buffer += value;
+        const messages = buffer.split("\n\n");
+        buffer = messages.pop() ?? "";
+        for (const message of messages) {
+            let type = "message";
+            let data = "";
+            for (const line of message.split("\n")) {
+                if (line.startsWith("event: ")) type = line.substring(7);
+                if (line.startsWith("data: ")) data += line.substring(6);
+            }
+            if (data.length > 0) onEvent(type, data);
+        }
+    }
+}
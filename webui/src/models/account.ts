@@ -0,0 +1,9 @@
+
+export interface Account {
+    username: string;
+    is_admin: boolean;
+    documents: number;
+    history_entries: number;
+    aliases: number;
+    webhooks: number;
+}
@@ -2,7 +2,19 @@
 export interface SyncDoc extends SyncDocData {
     id: string;
     pretty_name: string;
+    metadata: SyncDocMetadata;
     history: SyncDocData[];
+    aliases: string[];
+}
+
+export interface SyncDocMetadata {
+    title: string;
+    authors: string[];
+    series: string;
+    tags: string[];
+    notes: string;
+    cover_url: string;
+    status: 'reading' | 'finished' | 'abandoned';
 }
 
 export interface SyncDocData {
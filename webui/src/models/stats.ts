@@ -0,0 +1,25 @@
+
+export interface ReadingStats {
+    generated_at: number;
+    reading_time: number;
+    books_started: number;
+    books_finished: number;
+    current_streak: number;
+    longest_streak: number;
+    days: ReadingStatsDay[];
+    devices: ReadingStatsDevice[];
+}
+
+export interface ReadingStatsDay {
+    date: string;
+    reading_time: number;
+    percentage: number;
+    pushes: number;
+}
+
+export interface ReadingStatsDevice {
+    device: string;
+    device_id: string;
+    pushes: number;
+    last_seen: number;
+}
@@ -1,8 +1,9 @@
 import { createRouter, createWebHistory } from 'vue-router'
 import HomeView from '../views/HomeView.vue'
+import {PATH_PREFIX} from "@/api.ts";
 
 const router = createRouter({
-  history: createWebHistory(import.meta.env.BASE_URL),
+  history: createWebHistory(PATH_PREFIX + import.meta.env.BASE_URL),
   routes: [
     {
       path: '/',
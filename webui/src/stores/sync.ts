@@ -1,7 +1,7 @@
 import { ref, computed } from 'vue'
 import { defineStore } from 'pinia'
 import type {SyncDoc} from "@/models/document.ts";
-import {fetchApi} from "@/api.ts";
+import {fetchApi, streamApi} from "@/api.ts";
 
 export const useSyncStore = defineStore('sync', () => {
   const syncStateEncoded = sessionStorage.getItem('syncState')
@@ -27,10 +27,22 @@ export const useSyncStore = defineStore('sync', () => {
     sessionStorage.setItem('syncState', btoa(JSON.stringify(sync.value)))
   }
 
+  let watcher: AbortController | null = null
+
+  // Refresh the documents whenever the server reports a change
+  function watch() {
+    if (watcher !== null) return;
+    watcher = new AbortController();
+    streamApi("/api/events", () => doSync(true), watcher.signal)
+      .catch(() => {})
+      .finally(() => watcher = null);
+  }
+
   function clear() {
+    watcher?.abort()
     sessionStorage.removeItem('syncState')
     sync.value = {lastSync: -1, documents: []}
   }
 
-  return { sync, doSync, clear }
+  return { sync, doSync, watch, clear }
 })